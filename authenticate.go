@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Skorgum/Chirpy/internal/auth"
+	"github.com/Skorgum/Chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// lastUsedInterval is how stale the last_used_at of a session or personal
+// access token may get before a request using it updates it.
+const lastUsedInterval = time.Minute
+
+var (
+	errTokenRevoked      = errors.New("token has been revoked or has expired")
+	errInsufficientScope = errors.New("token lacks the required scope")
+)
+
+// authenticate validates the request's bearer token, which may be an access
+// token or a personal access token, rejects it if it has been revoked, and
+// checks that it carries scope.
+func (cfg *apiConfig) authenticate(r *http.Request, scope string) (auth.Claims, error) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		return auth.Claims{}, err
+	}
+
+	if auth.IsPersonalAccessToken(token) {
+		claims, err := cfg.authenticatePersonalAccessToken(r.Context(), token)
+		if err != nil {
+			return auth.Claims{}, err
+		}
+		if !claims.HasScope(scope) {
+			return auth.Claims{}, fmt.Errorf("%w %q", errInsufficientScope, scope)
+		}
+		return claims, nil
+	}
+
+	claims, err := auth.ValidateJWT(token, cfg.jwtKeys, auth.TokenTypeAccess)
+	if err != nil {
+		return auth.Claims{}, err
+	}
+
+	revoked, err := cfg.db.IsAccessTokenRevoked(r.Context(), claims.ID)
+	if err != nil {
+		return auth.Claims{}, err
+	}
+	if revoked {
+		return auth.Claims{}, errTokenRevoked
+	}
+
+	if !claims.HasScope(scope) {
+		return auth.Claims{}, fmt.Errorf("%w %q", errInsufficientScope, scope)
+	}
+
+	if claims.SessionID != uuid.Nil {
+		if err := cfg.touchSession(r.Context(), claims.SessionID); err != nil {
+			return auth.Claims{}, err
+		}
+	}
+	return claims, nil
+}
+
+// touchSession records that a session's access token was used, so the
+// session list shows when each device was last active. It writes at most
+// once per lastUsedInterval.
+func (cfg *apiConfig) touchSession(ctx context.Context, sessionID uuid.UUID) error {
+	now := time.Now().UTC()
+	return cfg.db.TouchSession(ctx, database.TouchSessionParams{
+		Now:           now,
+		SessionID:     sessionID,
+		TouchedBefore: now.Add(-lastUsedInterval),
+	})
+}
+
+func (cfg *apiConfig) authenticatePersonalAccessToken(ctx context.Context, token string) (auth.Claims, error) {
+	pat, err := cfg.db.GetActivePersonalAccessToken(ctx, auth.HashToken(token))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return auth.Claims{}, errTokenRevoked
+		}
+		return auth.Claims{}, err
+	}
+
+	if !pat.LastUsedAt.Valid || time.Since(pat.LastUsedAt.Time) >= lastUsedInterval {
+		now := time.Now().UTC()
+		err := cfg.db.TouchPersonalAccessToken(ctx, database.TouchPersonalAccessTokenParams{
+			Now:           now,
+			ID:            pat.ID,
+			TouchedBefore: now.Add(-lastUsedInterval),
+		})
+		if err != nil {
+			return auth.Claims{}, err
+		}
+	}
+
+	return auth.Claims{
+		UserID:    pat.UserID,
+		ID:        pat.ID.String(),
+		Type:      auth.TokenTypePersonal,
+		Scopes:    pat.Scopes,
+		ExpiresAt: pat.ExpiresAt.Time,
+	}, nil
+}
+
+// respondWithAuthError reports a failed authenticate call: 403 if the token
+// was fine but not allowed to do this, 401 otherwise.
+func respondWithAuthError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errInsufficientScope) {
+		respondWithError(w, http.StatusForbidden, "Token is missing the required scope", err)
+		return
+	}
+	respondWithError(w, http.StatusUnauthorized, "Unauthorized", err)
+}
+
+// revokeAccessToken stops the access token behind claims from being accepted
+// for the rest of its lifetime.
+func (cfg *apiConfig) revokeAccessToken(ctx context.Context, claims auth.Claims) error {
+	if err := cfg.db.DeleteExpiredRevokedAccessTokens(ctx); err != nil {
+		return err
+	}
+	return cfg.db.RevokeAccessToken(ctx, database.RevokeAccessTokenParams{
+		Jti:       claims.ID,
+		UserID:    claims.UserID,
+		ExpiresAt: claims.ExpiresAt,
+	})
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+
+	"github.com/Skorgum/Chirpy/internal/database"
+	"github.com/Skorgum/Chirpy/internal/entities"
+	"github.com/google/uuid"
+)
+
+type ChirpEntity struct {
+	Text      string     `json:"text"`
+	ByteStart int32      `json:"byte_start"`
+	ByteEnd   int32      `json:"byte_end"`
+	CharStart int32      `json:"char_start"`
+	CharEnd   int32      `json:"char_end"`
+	UserID    *uuid.UUID `json:"user_id,omitempty"`
+}
+
+type ChirpEntities struct {
+	Hashtags []ChirpEntity `json:"hashtags"`
+	Mentions []ChirpEntity `json:"mentions"`
+	URLs     []ChirpEntity `json:"urls"`
+}
+
+func newChirpEntities() ChirpEntities {
+	return ChirpEntities{
+		Hashtags: []ChirpEntity{},
+		Mentions: []ChirpEntity{},
+		URLs:     []ChirpEntity{},
+	}
+}
+
+// saveChirpEntities parses the chirp body and stores its hashtags, mentions
+// and URLs, resolving mentions to users by username. Callers replacing a body
+// must delete the old entities first.
+func saveChirpEntities(ctx context.Context, q *database.Queries, chirp database.Chirp) error {
+	parsed := entities.Parse(chirp.Body)
+
+	var handles []string
+	for _, e := range parsed {
+		if e.Kind == entities.KindMention {
+			handles = append(handles, e.Normalized)
+		}
+	}
+	mentioned := map[string]uuid.UUID{}
+	if len(handles) > 0 {
+		users, err := q.GetUsersByUsernames(ctx, handles)
+		if err != nil {
+			return err
+		}
+		for _, u := range users {
+			mentioned[u.Username] = u.ID
+		}
+	}
+
+	for _, e := range parsed {
+		userID := uuid.NullUUID{}
+		if id, ok := mentioned[e.Normalized]; ok && e.Kind == entities.KindMention {
+			userID = uuid.NullUUID{UUID: id, Valid: true}
+		}
+
+		err := q.CreateChirpEntity(ctx, database.CreateChirpEntityParams{
+			ChirpID:    chirp.ID,
+			Kind:       string(e.Kind),
+			Text:       e.Text,
+			Normalized: e.Normalized,
+			UserID:     userID,
+			ByteStart:  int32(e.ByteStart),
+			ByteEnd:    int32(e.ByteEnd),
+			CharStart:  int32(e.CharStart),
+			CharEnd:    int32(e.CharEnd),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadChirpEntities fetches the entities for every chirp in one query.
+func (cfg *apiConfig) loadChirpEntities(ctx context.Context, chirpIDs []uuid.UUID) (map[uuid.UUID]ChirpEntities, error) {
+	dbEntities, err := cfg.db.ListChirpEntities(ctx, chirpIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	byChirp := make(map[uuid.UUID]ChirpEntities, len(chirpIDs))
+	for _, dbEntity := range dbEntities {
+		chirpEntities, ok := byChirp[dbEntity.ChirpID]
+		if !ok {
+			chirpEntities = newChirpEntities()
+		}
+
+		entity := ChirpEntity{
+			Text:      dbEntity.Text,
+			ByteStart: dbEntity.ByteStart,
+			ByteEnd:   dbEntity.ByteEnd,
+			CharStart: dbEntity.CharStart,
+			CharEnd:   dbEntity.CharEnd,
+		}
+		if dbEntity.UserID.Valid {
+			userID := dbEntity.UserID.UUID
+			entity.UserID = &userID
+		}
+
+		switch entities.Kind(dbEntity.Kind) {
+		case entities.KindHashtag:
+			chirpEntities.Hashtags = append(chirpEntities.Hashtags, entity)
+		case entities.KindMention:
+			chirpEntities.Mentions = append(chirpEntities.Mentions, entity)
+		case entities.KindURL:
+			chirpEntities.URLs = append(chirpEntities.URLs, entity)
+		}
+		byChirp[dbEntity.ChirpID] = chirpEntities
+	}
+	return byChirp, nil
+}
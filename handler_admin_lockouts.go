@@ -0,0 +1,96 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Skorgum/Chirpy/internal/auth"
+	"github.com/Skorgum/Chirpy/internal/database"
+)
+
+type LoginLockout struct {
+	Scope         string    `json:"scope"`
+	Key           string    `json:"key"`
+	Failures      int32     `json:"failures"`
+	LastFailureAt time.Time `json:"last_failure_at"`
+	LockedUntil   time.Time `json:"locked_until"`
+}
+
+// requireAdmin checks the ApiKey header against ADMIN_API_KEY. The admin
+// endpoints that need it are disabled when no key is configured.
+func (cfg *apiConfig) requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if cfg.adminAPIKey == "" {
+		respondWithError(w, http.StatusForbidden, "Admin API is disabled", nil)
+		return false
+	}
+	key, err := auth.GetAPIKey(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized", err)
+		return false
+	}
+	if subtle.ConstantTimeCompare([]byte(key), []byte(cfg.adminAPIKey)) != 1 {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized", nil)
+		return false
+	}
+	return true
+}
+
+// handlerLockoutsGet lists the emails and IPs currently refused logins.
+func (cfg *apiConfig) handlerLockoutsGet(w http.ResponseWriter, r *http.Request) {
+	if !cfg.requireAdmin(w, r) {
+		return
+	}
+
+	throttles, err := cfg.db.ListLockedLoginThrottles(r.Context(), cfg.clock())
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve lockouts", err)
+		return
+	}
+
+	lockouts := make([]LoginLockout, 0, len(throttles))
+	for _, t := range throttles {
+		lockouts = append(lockouts, LoginLockout{
+			Scope:         t.Scope,
+			Key:           t.Key,
+			Failures:      t.Failures,
+			LastFailureAt: t.LastFailureAt,
+			LockedUntil:   t.LockedUntil,
+		})
+	}
+	respondWithJSON(w, http.StatusOK, lockouts)
+}
+
+// handlerLockoutDelete clears the failed attempts recorded against an email
+// (scope "account") or IP address (scope "ip"), or the password reset
+// mails sent to an email ("reset_email") or requests from an IP
+// ("reset_ip"), lifting any lockout.
+func (cfg *apiConfig) handlerLockoutDelete(w http.ResponseWriter, r *http.Request) {
+	if !cfg.requireAdmin(w, r) {
+		return
+	}
+
+	scope := r.PathValue("scope")
+	switch scope {
+	case throttleScopeAccount, throttleScopeIP, throttleScopeResetEmail, throttleScopeResetIP:
+	default:
+		respondWithError(w, http.StatusBadRequest, "Invalid scope", errors.New("scope must be account, ip, reset_email or reset_ip"))
+		return
+	}
+
+	cleared, err := cfg.db.ClearLoginThrottle(r.Context(), database.ClearLoginThrottleParams{
+		Scope: scope,
+		Key:   r.PathValue("key"),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't clear lockout", err)
+		return
+	}
+	if cleared == 0 {
+		respondWithError(w, http.StatusNotFound, "No failed logins recorded", nil)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
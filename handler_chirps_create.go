@@ -1,6 +1,8 @@
 package main
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
 	"errors"
 	"net/http"
@@ -13,28 +15,43 @@ import (
 )
 
 type Chirp struct {
-	ID        uuid.UUID `json:"id"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	UserID    uuid.UUID `json:"user_id"`
-	Body      string    `json:"body"`
+	ID             uuid.UUID     `json:"id"`
+	CreatedAt      time.Time     `json:"created_at"`
+	UpdatedAt      time.Time     `json:"updated_at"`
+	UserID         uuid.UUID     `json:"user_id"`
+	Body           string        `json:"body"`
+	InReplyTo      *uuid.UUID    `json:"in_reply_to,omitempty"`
+	ConversationID uuid.UUID     `json:"conversation_id"`
+	LikeCount      int32         `json:"like_count"`
+	QuotedChirpID  *uuid.UUID    `json:"quoted_chirp_id,omitempty"`
+	QuotedChirp    *Chirp        `json:"quoted_chirp,omitempty"`
+	RechirpOfID    *uuid.UUID    `json:"rechirp_of_id,omitempty"`
+	RechirpOf      *Chirp        `json:"rechirp_of,omitempty"`
+	Entities       ChirpEntities `json:"entities"`
+	Deleted        bool          `json:"deleted,omitempty"`
 }
 
 func (apiCfg *apiConfig) handlerChirpsCreate(w http.ResponseWriter, r *http.Request) {
-	token, err := auth.GetBearerToken(r.Header)
+	claims, err := apiCfg.authenticate(r, auth.ScopeChirpsWrite)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Unauthorized", err)
+		respondWithAuthError(w, err)
 		return
 	}
+	userID := claims.UserID
 
-	userID, err := auth.ValidateJWT(token, apiCfg.jwtSecret)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Unauthorized", err)
+	if err := apiCfg.ensureEmailVerified(r.Context(), userID); err != nil {
+		if errors.Is(err, errEmailNotVerified) {
+			respondWithError(w, http.StatusForbidden, "Verify your email address before chirping", err)
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Couldn't load user", err)
 		return
 	}
 
 	type parameters struct {
-		Body string `json:"body"`
+		Body          string     `json:"body"`
+		InReplyTo     *uuid.UUID `json:"in_reply_to"`
+		QuotedChirpID *uuid.UUID `json:"quoted_chirp_id"`
 	}
 
 	var params parameters
@@ -49,22 +66,193 @@ func (apiCfg *apiConfig) handlerChirpsCreate(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	chirp, err := apiCfg.db.CreateChirp(r.Context(), database.CreateChirpParams{
+	createParams := database.CreateChirpParams{
 		Body:   cleaned,
 		UserID: userID,
-	})
+	}
+	if params.InReplyTo != nil {
+		// Replies to a rechirp belong in the original chirp's thread.
+		parent, err := apiCfg.getOriginalChirp(r.Context(), *params.InReplyTo)
+		if err != nil {
+			respondWithError(w, http.StatusNotFound, "Chirp being replied to not found", err)
+			return
+		}
+		createParams.InReplyTo = uuid.NullUUID{UUID: parent.ID, Valid: true}
+		createParams.ConversationID = uuid.NullUUID{UUID: parent.ConversationID, Valid: true}
+	}
+	if params.QuotedChirpID != nil {
+		quoted, err := apiCfg.getOriginalChirp(r.Context(), *params.QuotedChirpID)
+		if err != nil {
+			respondWithError(w, http.StatusNotFound, "Quoted chirp not found", err)
+			return
+		}
+		createParams.QuotedChirpID = uuid.NullUUID{UUID: quoted.ID, Valid: true}
+	}
+
+	tx, err := apiCfg.dbConn.BeginTx(r.Context(), nil)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Failed to create chirp", err)
 		return
 	}
+	defer tx.Rollback()
+	qtx := apiCfg.db.WithTx(tx)
+
+	chirp, err := qtx.CreateChirp(r.Context(), createParams)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to create chirp", err)
+		return
+	}
+
+	if err := saveChirpEntities(r.Context(), qtx, chirp); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to create chirp", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to create chirp", err)
+		return
+	}
+
+	apiCfg.respondWithChirp(w, r, http.StatusCreated, chirp)
+}
+
+func chirpFromDB(dbChirp database.Chirp) Chirp {
+	chirp := Chirp{
+		ID:             dbChirp.ID,
+		CreatedAt:      dbChirp.CreatedAt,
+		UpdatedAt:      dbChirp.UpdatedAt,
+		UserID:         dbChirp.UserID,
+		Body:           dbChirp.Body,
+		ConversationID: dbChirp.ConversationID,
+		LikeCount:      dbChirp.LikeCount,
+		Entities:       newChirpEntities(),
+		Deleted:        dbChirp.DeletedAt.Valid,
+	}
+	if dbChirp.InReplyTo.Valid {
+		inReplyTo := dbChirp.InReplyTo.UUID
+		chirp.InReplyTo = &inReplyTo
+	}
+	if dbChirp.QuotedChirpID.Valid {
+		quotedChirpID := dbChirp.QuotedChirpID.UUID
+		chirp.QuotedChirpID = &quotedChirpID
+	}
+	if dbChirp.RechirpOf.Valid {
+		rechirpOf := dbChirp.RechirpOf.UUID
+		chirp.RechirpOfID = &rechirpOf
+	}
+	return chirp
+}
+
+// chirpsResponse converts chirps for the API, attaching their entities and
+// embedding the chirps they quote or rechirp. Referenced chirps and entities
+// are each fetched in a single query. Deleted originals are embedded as
+// tombstones.
+func (apiCfg *apiConfig) chirpsResponse(ctx context.Context, dbChirps []database.Chirp) ([]Chirp, error) {
+	chirps := make([]Chirp, 0, len(dbChirps))
+	chirpIDs := make([]uuid.UUID, 0, len(dbChirps))
+	var refIDs []uuid.UUID
+	for _, dbChirp := range dbChirps {
+		chirp := chirpFromDB(dbChirp)
+		if chirp.QuotedChirpID != nil {
+			refIDs = append(refIDs, *chirp.QuotedChirpID)
+		}
+		if chirp.RechirpOfID != nil {
+			refIDs = append(refIDs, *chirp.RechirpOfID)
+		}
+		chirps = append(chirps, chirp)
+		chirpIDs = append(chirpIDs, chirp.ID)
+	}
+	if len(chirps) == 0 {
+		return chirps, nil
+	}
 
-	respondWithJSON(w, http.StatusCreated, Chirp{
-		ID:        chirp.ID,
-		CreatedAt: chirp.CreatedAt,
-		UpdatedAt: chirp.UpdatedAt,
-		Body:      chirp.Body,
-		UserID:    chirp.UserID,
-	})
+	refs := make(map[uuid.UUID]Chirp, len(refIDs))
+	if len(refIDs) > 0 {
+		dbRefs, err := apiCfg.db.GetChirpsByIDs(ctx, refIDs)
+		if err != nil {
+			return nil, err
+		}
+		for _, dbRef := range dbRefs {
+			refs[dbRef.ID] = chirpFromDB(dbRef)
+			chirpIDs = append(chirpIDs, dbRef.ID)
+		}
+	}
+
+	chirpEntities, err := apiCfg.loadChirpEntities(ctx, chirpIDs)
+	if err != nil {
+		return nil, err
+	}
+	for id, ref := range refs {
+		if e, ok := chirpEntities[id]; ok {
+			ref.Entities = e
+			refs[id] = ref
+		}
+	}
+
+	for i := range chirps {
+		if e, ok := chirpEntities[chirps[i].ID]; ok {
+			chirps[i].Entities = e
+		}
+		if id := chirps[i].QuotedChirpID; id != nil {
+			if ref, ok := refs[*id]; ok {
+				chirps[i].QuotedChirp = &ref
+			}
+		}
+		if id := chirps[i].RechirpOfID; id != nil {
+			if ref, ok := refs[*id]; ok {
+				chirps[i].RechirpOf = &ref
+			}
+		}
+	}
+	return chirps, nil
+}
+
+// respondWithChirp writes a single chirp with any quoted or rechirped chirp
+// embedded.
+func (apiCfg *apiConfig) respondWithChirp(w http.ResponseWriter, r *http.Request, status int, dbChirp database.Chirp) {
+	chirps, err := apiCfg.chirpsResponse(r.Context(), []database.Chirp{dbChirp})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to get chirp", err)
+		return
+	}
+	respondWithJSON(w, status, chirps[0])
+}
+
+// respondWithChirpPage writes one page of chirps fetched with a limit of
+// page.Limit+1, setting the next-page link when the extra row came back.
+func (apiCfg *apiConfig) respondWithChirpPage(w http.ResponseWriter, r *http.Request, page pageParams, dbChirps []database.Chirp) {
+	if len(dbChirps) > int(page.Limit) {
+		dbChirps = dbChirps[:page.Limit]
+		last := dbChirps[len(dbChirps)-1]
+		setNextPageLink(w, r, page, pageCursor{CreatedAt: last.CreatedAt, ID: last.ID})
+	}
+
+	chirps, err := apiCfg.chirpsResponse(r.Context(), dbChirps)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to get chirps", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, chirps)
+}
+
+// getOriginalChirp fetches a live chirp, following a rechirp through to the
+// chirp it reposts.
+func (apiCfg *apiConfig) getOriginalChirp(ctx context.Context, chirpID uuid.UUID) (database.Chirp, error) {
+	dbChirp, err := apiCfg.db.GetChirp(ctx, chirpID)
+	if err != nil {
+		return database.Chirp{}, err
+	}
+	if dbChirp.RechirpOf.Valid {
+		dbChirp, err = apiCfg.db.GetChirp(ctx, dbChirp.RechirpOf.UUID)
+		if err != nil {
+			return database.Chirp{}, err
+		}
+	}
+	if dbChirp.DeletedAt.Valid {
+		return database.Chirp{}, sql.ErrNoRows
+	}
+	return dbChirp, nil
 }
 
 func validateChirp(body string) (string, error) {
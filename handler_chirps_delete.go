@@ -4,6 +4,7 @@ import (
 	"net/http"
 
 	"github.com/Skorgum/Chirpy/internal/auth"
+	"github.com/Skorgum/Chirpy/internal/database"
 	"github.com/google/uuid"
 )
 
@@ -17,21 +18,16 @@ func (cfg *apiConfig) handlerDeleteChirp(w http.ResponseWriter, r *http.Request)
 	}
 
 	// get user ID from Auth header
-	token, err := auth.GetBearerToken(r.Header)
+	claims, err := cfg.authenticate(r, auth.ScopeChirpsWrite)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Unauthorized", err)
-		return
-	}
-
-	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Unauthorized", err)
+		respondWithAuthError(w, err)
 		return
 	}
+	userID := claims.UserID
 
 	// Fetch chirp from DB by ID
 	dbChirp, err := cfg.db.GetChirp(r.Context(), chirpID)
-	if err != nil {
+	if err != nil || dbChirp.DeletedAt.Valid {
 		respondWithError(w, http.StatusNotFound, "Chirp not found", err)
 		return
 	}
@@ -41,8 +37,51 @@ func (cfg *apiConfig) handlerDeleteChirp(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Delete chirp from DB
-	if err := cfg.db.DeleteChirp(r.Context(), chirpID); err != nil {
+	// A rechirp has no content of its own, so it can simply go away.
+	if dbChirp.RechirpOf.Valid {
+		_, err := cfg.db.DeleteRechirp(r.Context(), database.DeleteRechirpParams{
+			UserID:    userID,
+			RechirpOf: dbChirp.RechirpOf,
+		})
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Failed to delete chirp", err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	// Replace the chirp with a tombstone so replies and quotes keep pointing
+	// at something. Its edit history, entities and rechirps go with the body.
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to delete chirp", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	if err := qtx.DeleteChirp(r.Context(), chirpID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to delete chirp", err)
+		return
+	}
+
+	if err := qtx.DeleteChirpRevisions(r.Context(), chirpID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to delete chirp", err)
+		return
+	}
+
+	if err := qtx.DeleteChirpEntities(r.Context(), chirpID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to delete chirp", err)
+		return
+	}
+
+	if err := qtx.DeleteRechirpsOf(r.Context(), uuid.NullUUID{UUID: chirpID, Valid: true}); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to delete chirp", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Failed to delete chirp", err)
 		return
 	}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/Skorgum/Chirpy/internal/database"
+	"github.com/Skorgum/Chirpy/internal/entities"
+	"github.com/google/uuid"
+)
+
+func (cfg *apiConfig) handlerHashtagChirpsGet(w http.ResponseWriter, r *http.Request) {
+	tag := entities.NormalizeHashtag(r.PathValue("tag"))
+	if tag == "" {
+		respondWithError(w, http.StatusBadRequest, "Invalid hashtag", nil)
+		return
+	}
+
+	page, err := parseNewestFirstPageParams(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	dbChirps, err := cfg.db.ListHashtagChirps(r.Context(), database.ListHashtagChirpsParams{
+		Tag:             tag,
+		CursorCreatedAt: page.Cursor.CreatedAt,
+		CursorID:        page.Cursor.ID,
+		Limit:           page.Limit + 1,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to get chirps", err)
+		return
+	}
+
+	cfg.respondWithChirpPage(w, r, page, dbChirps)
+}
+
+func (cfg *apiConfig) handlerMentionChirpsGet(w http.ResponseWriter, r *http.Request) {
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID", err)
+		return
+	}
+
+	page, err := parseNewestFirstPageParams(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	dbChirps, err := cfg.db.ListMentionChirps(r.Context(), database.ListMentionChirpsParams{
+		UserID:          uuid.NullUUID{UUID: userID, Valid: true},
+		CursorCreatedAt: page.Cursor.CreatedAt,
+		CursorID:        page.Cursor.ID,
+		Limit:           page.Limit + 1,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to get chirps", err)
+		return
+	}
+
+	cfg.respondWithChirpPage(w, r, page, dbChirps)
+}
@@ -2,75 +2,65 @@ package main
 
 import (
 	"net/http"
-	"sort"
 
+	"github.com/Skorgum/Chirpy/internal/database"
 	"github.com/google/uuid"
 )
 
 func (apiCfg *apiConfig) handlerChirpsGetAll(w http.ResponseWriter, r *http.Request) {
-	dbChirps, err := apiCfg.db.GetChirps(r.Context())
+	page, err := parsePageParams(r.URL.Query(), false)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Failed to get chirps", err)
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
 		return
 	}
 
-	authorIDStr := r.URL.Query().Get("author_id")
-
-	sortOrder := r.URL.Query().Get("sort")
-	if sortOrder != "desc" {
-		sortOrder = "asc"
-	}
+	// Fetch one extra row to find out whether there is a next page.
+	fetchLimit := page.Limit + 1
 
+	var dbChirps []database.Chirp
+	authorIDStr := r.URL.Query().Get("author_id")
 	if authorIDStr == "" {
-		chirps := []Chirp{}
-		for _, dbChirp := range dbChirps {
-			chirps = append(chirps, Chirp{
-				ID:        dbChirp.ID,
-				CreatedAt: dbChirp.CreatedAt,
-				UpdatedAt: dbChirp.UpdatedAt,
-				UserID:    dbChirp.UserID,
-				Body:      dbChirp.Body,
+		if page.Desc {
+			dbChirps, err = apiCfg.db.ListChirpsDesc(r.Context(), database.ListChirpsDescParams{
+				CursorCreatedAt: page.Cursor.CreatedAt,
+				CursorID:        page.Cursor.ID,
+				Limit:           fetchLimit,
+			})
+		} else {
+			dbChirps, err = apiCfg.db.ListChirpsAsc(r.Context(), database.ListChirpsAscParams{
+				CursorCreatedAt: page.Cursor.CreatedAt,
+				CursorID:        page.Cursor.ID,
+				Limit:           fetchLimit,
+			})
+		}
+	} else {
+		authorID, parseErr := uuid.Parse(authorIDStr)
+		if parseErr != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid author ID", parseErr)
+			return
+		}
+		if page.Desc {
+			dbChirps, err = apiCfg.db.ListChirpsByAuthorDesc(r.Context(), database.ListChirpsByAuthorDescParams{
+				UserID:          authorID,
+				CursorCreatedAt: page.Cursor.CreatedAt,
+				CursorID:        page.Cursor.ID,
+				Limit:           fetchLimit,
+			})
+		} else {
+			dbChirps, err = apiCfg.db.ListChirpsByAuthorAsc(r.Context(), database.ListChirpsByAuthorAscParams{
+				UserID:          authorID,
+				CursorCreatedAt: page.Cursor.CreatedAt,
+				CursorID:        page.Cursor.ID,
+				Limit:           fetchLimit,
 			})
 		}
-
-		sort.Slice(chirps, func(i, j int) bool {
-			if sortOrder == "desc" {
-				return chirps[i].CreatedAt.After(chirps[j].CreatedAt)
-			}
-			return chirps[i].CreatedAt.Before(chirps[j].CreatedAt)
-		})
-
-		respondWithJSON(w, http.StatusOK, chirps)
-		return
 	}
-
-	authorID, err := uuid.Parse(authorIDStr)
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid author ID", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to get chirps", err)
 		return
 	}
 
-	chirps := []Chirp{}
-	for _, dbChirp := range dbChirps {
-		if dbChirp.UserID == authorID {
-			chirps = append(chirps, Chirp{
-				ID:        dbChirp.ID,
-				CreatedAt: dbChirp.CreatedAt,
-				UpdatedAt: dbChirp.UpdatedAt,
-				UserID:    dbChirp.UserID,
-				Body:      dbChirp.Body,
-			})
-		}
-	}
-
-	sort.Slice(chirps, func(i, j int) bool {
-		if sortOrder == "desc" {
-			return chirps[i].CreatedAt.After(chirps[j].CreatedAt)
-		}
-		return chirps[i].CreatedAt.Before(chirps[j].CreatedAt)
-	})
-
-	respondWithJSON(w, http.StatusOK, chirps)
+	apiCfg.respondWithChirpPage(w, r, page, dbChirps)
 }
 
 func (apiCfg *apiConfig) handlerChirpsGet(w http.ResponseWriter, r *http.Request) {
@@ -86,12 +76,10 @@ func (apiCfg *apiConfig) handlerChirpsGet(w http.ResponseWriter, r *http.Request
 		respondWithError(w, http.StatusNotFound, "Failed to get chirp", err)
 		return
 	}
+	if dbChirp.DeletedAt.Valid {
+		respondWithError(w, http.StatusNotFound, "Chirp not found", nil)
+		return
+	}
 
-	respondWithJSON(w, http.StatusOK, Chirp{
-		ID:        dbChirp.ID,
-		CreatedAt: dbChirp.CreatedAt,
-		UpdatedAt: dbChirp.UpdatedAt,
-		UserID:    dbChirp.UserID,
-		Body:      dbChirp.Body,
-	})
+	apiCfg.respondWithChirp(w, r, http.StatusOK, dbChirp)
 }
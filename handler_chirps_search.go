@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"html"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Skorgum/Chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// snippetMarkers turns the STX and ETX characters search.sql has
+// ts_headline put around matches into <mark> tags. The body is stripped of
+// both before highlighting, so they only ever come from ts_headline.
+var snippetMarkers = strings.NewReplacer("\x02", "<mark>", "\x03", "</mark>")
+
+type ChirpSearchResult struct {
+	Chirp
+	Rank    float32 `json:"rank"`
+	Snippet string  `json:"snippet"`
+}
+
+// handlerChirpsSearch runs a web-search style query over chirp bodies. The
+// query syntax is Postgres' websearch_to_tsquery: "quoted phrases", -excluded
+// terms and OR are all supported.
+func (apiCfg *apiConfig) handlerChirpsSearch(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	q := strings.TrimSpace(query.Get("q"))
+	if q == "" {
+		respondWithError(w, http.StatusBadRequest, "Search query is required", nil)
+		return
+	}
+
+	authorID := uuid.NullUUID{}
+	if authorIDStr := query.Get("author_id"); authorIDStr != "" {
+		id, err := uuid.Parse(authorIDStr)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid author ID", err)
+			return
+		}
+		authorID = uuid.NullUUID{UUID: id, Valid: true}
+	}
+
+	limit, err := parsePageLimit(query)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	sortOrder := query.Get("sort")
+	if sortOrder == "" {
+		sortOrder = "relevance"
+	}
+
+	var matches []searchMatch
+	switch sortOrder {
+	case "relevance":
+		cursor := rankCursor{Rank: math.MaxFloat32, ID: uuid.Max}
+		if cursorStr := query.Get("cursor"); cursorStr != "" {
+			cursor, err = decodeRankCursor(cursorStr)
+			if err != nil {
+				respondWithError(w, http.StatusBadRequest, err.Error(), err)
+				return
+			}
+		}
+
+		rows, err := apiCfg.db.SearchChirpsByRank(r.Context(), database.SearchChirpsByRankParams{
+			Query:      q,
+			AuthorID:   authorID,
+			CursorRank: cursor.Rank,
+			CursorID:   cursor.ID,
+			Limit:      limit + 1,
+		})
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Failed to search chirps", err)
+			return
+		}
+		if len(rows) > int(limit) {
+			rows = rows[:limit]
+			last := rows[len(rows)-1]
+			next := r.URL.Query()
+			next.Set("cursor", encodeRankCursor(rankCursor{Rank: last.Rank, ID: last.Chirp.ID}))
+			next.Set("limit", strconv.Itoa(int(limit)))
+			setNextLink(w, r, next)
+		}
+		for _, row := range rows {
+			matches = append(matches, searchMatch{chirp: row.Chirp, rank: row.Rank, snippet: row.Snippet})
+		}
+	case "recent":
+		cursor := firstPageCursor(true)
+		if cursorStr := query.Get("cursor"); cursorStr != "" {
+			cursor, err = decodeCursor(cursorStr)
+			if err != nil {
+				respondWithError(w, http.StatusBadRequest, err.Error(), err)
+				return
+			}
+		}
+
+		rows, err := apiCfg.db.SearchChirpsByRecency(r.Context(), database.SearchChirpsByRecencyParams{
+			Query:           q,
+			AuthorID:        authorID,
+			CursorCreatedAt: cursor.CreatedAt,
+			CursorID:        cursor.ID,
+			Limit:           limit + 1,
+		})
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Failed to search chirps", err)
+			return
+		}
+		if len(rows) > int(limit) {
+			rows = rows[:limit]
+			last := rows[len(rows)-1]
+			next := r.URL.Query()
+			next.Set("cursor", encodeCursor(pageCursor{CreatedAt: last.Chirp.CreatedAt, ID: last.Chirp.ID}))
+			next.Set("limit", strconv.Itoa(int(limit)))
+			setNextLink(w, r, next)
+		}
+		for _, row := range rows {
+			matches = append(matches, searchMatch{chirp: row.Chirp, rank: row.Rank, snippet: row.Snippet})
+		}
+	default:
+		respondWithError(w, http.StatusBadRequest, "sort must be relevance or recent", nil)
+		return
+	}
+
+	dbChirps := make([]database.Chirp, 0, len(matches))
+	for _, m := range matches {
+		dbChirps = append(dbChirps, m.chirp)
+	}
+	chirps, err := apiCfg.chirpsResponse(r.Context(), dbChirps)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to search chirps", err)
+		return
+	}
+
+	results := make([]ChirpSearchResult, 0, len(matches))
+	for i, m := range matches {
+		results = append(results, ChirpSearchResult{
+			Chirp:   chirps[i],
+			Rank:    m.rank,
+			Snippet: escapeSnippet(m.snippet),
+		})
+	}
+
+	respondWithJSON(w, http.StatusOK, results)
+}
+
+type searchMatch struct {
+	chirp   database.Chirp
+	rank    float32
+	snippet string
+}
+
+// escapeSnippet HTML-escapes a ts_headline snippet and turns its highlight
+// markers into <mark> tags, so clients can render it without trusting chirp
+// bodies.
+func escapeSnippet(snippet string) string {
+	return snippetMarkers.Replace(html.EscapeString(snippet))
+}
+
+// rankCursor is the keyset position for relevance-ordered search results.
+type rankCursor struct {
+	Rank float32
+	ID   uuid.UUID
+}
+
+func encodeRankCursor(c rankCursor) string {
+	raw := strconv.FormatFloat(float64(c.Rank), 'g', -1, 32) + "|" + c.ID.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeRankCursor(s string) (rankCursor, error) {
+	errInvalid := errors.New("invalid cursor")
+
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return rankCursor{}, errInvalid
+	}
+	rankStr, idStr, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return rankCursor{}, errInvalid
+	}
+	rank, err := strconv.ParseFloat(rankStr, 32)
+	if err != nil {
+		return rankCursor{}, errInvalid
+	}
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		return rankCursor{}, errInvalid
+	}
+	return rankCursor{Rank: float32(rank), ID: id}, nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+type ChirpThreadNode struct {
+	Chirp
+	Replies []ChirpThreadNode `json:"replies"`
+}
+
+type ChirpThread struct {
+	Ancestors []Chirp         `json:"ancestors"`
+	Chirp     ChirpThreadNode `json:"chirp"`
+}
+
+func (cfg *apiConfig) handlerChirpThreadGet(w http.ResponseWriter, r *http.Request) {
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid chirp ID", err)
+		return
+	}
+
+	dbChirp, err := cfg.db.GetChirp(r.Context(), chirpID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Chirp not found", err)
+		return
+	}
+
+	// Every chirp in a thread shares the root's conversation ID, so a single
+	// query is enough to walk both up and down the reply tree.
+	conversation, err := cfg.db.ListConversationChirps(r.Context(), dbChirp.ConversationID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to get thread", err)
+		return
+	}
+
+	chirps, err := cfg.chirpsResponse(r.Context(), conversation)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to get thread", err)
+		return
+	}
+
+	byID := make(map[uuid.UUID]Chirp, len(chirps))
+	children := make(map[uuid.UUID][]Chirp)
+	for _, c := range chirps {
+		byID[c.ID] = c
+		if c.InReplyTo != nil {
+			children[*c.InReplyTo] = append(children[*c.InReplyTo], c)
+		}
+	}
+
+	chirp, ok := byID[dbChirp.ID]
+	if !ok {
+		respondWithError(w, http.StatusInternalServerError, "Failed to get thread", nil)
+		return
+	}
+
+	ancestors := []Chirp{}
+	for parentID := chirp.InReplyTo; parentID != nil; {
+		parent, ok := byID[*parentID]
+		if !ok {
+			break
+		}
+		ancestors = append(ancestors, parent)
+		parentID = parent.InReplyTo
+	}
+	// Root first.
+	for i, j := 0, len(ancestors)-1; i < j; i, j = i+1, j-1 {
+		ancestors[i], ancestors[j] = ancestors[j], ancestors[i]
+	}
+
+	respondWithJSON(w, http.StatusOK, ChirpThread{
+		Ancestors: ancestors,
+		Chirp:     buildThreadNode(chirp, children),
+	})
+}
+
+// buildThreadNode builds the reply tree below c. Deleted chirps are kept as
+// tombstones only while they still have replies hanging off them.
+func buildThreadNode(c Chirp, children map[uuid.UUID][]Chirp) ChirpThreadNode {
+	node := ChirpThreadNode{
+		Chirp:   c,
+		Replies: []ChirpThreadNode{},
+	}
+	for _, child := range children[c.ID] {
+		reply := buildThreadNode(child, children)
+		if reply.Deleted && len(reply.Replies) == 0 {
+			continue
+		}
+		node.Replies = append(node.Replies, reply)
+	}
+	return node
+}
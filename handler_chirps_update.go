@@ -0,0 +1,189 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Skorgum/Chirpy/internal/auth"
+	"github.com/Skorgum/Chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	chirpEditWindow    = 30 * time.Minute
+	chirpRedEditWindow = 24 * time.Hour
+)
+
+type ChirpRevision struct {
+	ID        uuid.UUID `json:"id"`
+	ChirpID   uuid.UUID `json:"chirp_id"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (cfg *apiConfig) handlerChirpsUpdate(w http.ResponseWriter, r *http.Request) {
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid chirp ID", err)
+		return
+	}
+
+	claims, err := cfg.authenticate(r, auth.ScopeChirpsWrite)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+	userID := claims.UserID
+
+	if err := cfg.ensureEmailVerified(r.Context(), userID); err != nil {
+		if errors.Is(err, errEmailNotVerified) {
+			respondWithError(w, http.StatusForbidden, "Verify your email address before editing chirps", err)
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Couldn't load user", err)
+		return
+	}
+
+	type parameters struct {
+		Body string `json:"body"`
+	}
+
+	var params parameters
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters", err)
+		return
+	}
+
+	cleaned, err := validateChirp(params.Body)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	user, err := cfg.db.GetUserByID(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized", err)
+		return
+	}
+
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to update chirp", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	// Lock the chirp so concurrent edits can't both record the same
+	// previous body as their revision.
+	dbChirp, err := qtx.GetChirpForUpdate(r.Context(), chirpID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusNotFound, "Chirp not found", err)
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Failed to get chirp", err)
+		return
+	}
+	if dbChirp.DeletedAt.Valid {
+		respondWithError(w, http.StatusNotFound, "Chirp not found", nil)
+		return
+	}
+
+	if dbChirp.UserID != userID {
+		respondWithError(w, http.StatusForbidden, "Forbidden", nil)
+		return
+	}
+
+	if dbChirp.RechirpOf.Valid {
+		respondWithError(w, http.StatusBadRequest, "Rechirps can't be edited", nil)
+		return
+	}
+
+	editWindow := chirpEditWindow
+	if user.IsChirpyRed {
+		editWindow = chirpRedEditWindow
+	}
+	if time.Since(dbChirp.CreatedAt) > editWindow {
+		respondWithError(w, http.StatusForbidden, "Edit window has expired", nil)
+		return
+	}
+
+	if cleaned == dbChirp.Body {
+		cfg.respondWithChirp(w, r, http.StatusOK, dbChirp)
+		return
+	}
+
+	err = qtx.CreateChirpRevision(r.Context(), database.CreateChirpRevisionParams{
+		ChirpID: dbChirp.ID,
+		Body:    dbChirp.Body,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to update chirp", err)
+		return
+	}
+
+	updated, err := qtx.UpdateChirpBody(r.Context(), database.UpdateChirpBodyParams{
+		ID:   dbChirp.ID,
+		Body: cleaned,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to update chirp", err)
+		return
+	}
+
+	if err := qtx.DeleteChirpEntities(r.Context(), updated.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to update chirp", err)
+		return
+	}
+	if err := saveChirpEntities(r.Context(), qtx, updated); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to update chirp", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to update chirp", err)
+		return
+	}
+
+	cfg.respondWithChirp(w, r, http.StatusOK, updated)
+}
+
+func (cfg *apiConfig) handlerChirpRevisionsGet(w http.ResponseWriter, r *http.Request) {
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid chirp ID", err)
+		return
+	}
+
+	dbChirp, err := cfg.db.GetChirp(r.Context(), chirpID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Chirp not found", err)
+		return
+	}
+	if dbChirp.DeletedAt.Valid {
+		respondWithError(w, http.StatusNotFound, "Chirp not found", nil)
+		return
+	}
+
+	dbRevisions, err := cfg.db.ListChirpRevisions(r.Context(), chirpID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to get revisions", err)
+		return
+	}
+
+	revisions := make([]ChirpRevision, 0, len(dbRevisions))
+	for _, dbRevision := range dbRevisions {
+		revisions = append(revisions, ChirpRevision{
+			ID:        dbRevision.ID,
+			ChirpID:   dbRevision.ChirpID,
+			Body:      dbRevision.Body,
+			CreatedAt: dbRevision.CreatedAt,
+		})
+	}
+
+	respondWithJSON(w, http.StatusOK, revisions)
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Skorgum/Chirpy/internal/auth"
+	"github.com/Skorgum/Chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+type Follow struct {
+	UserID     uuid.UUID `json:"user_id"`
+	FollowedAt time.Time `json:"followed_at"`
+}
+
+func (cfg *apiConfig) handlerFollowCreate(w http.ResponseWriter, r *http.Request) {
+	followeeID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID", err)
+		return
+	}
+
+	claims, err := cfg.authenticate(r, auth.ScopeChirpsWrite)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+	userID := claims.UserID
+
+	if followeeID == userID {
+		respondWithError(w, http.StatusBadRequest, "You can't follow yourself", nil)
+		return
+	}
+
+	if _, err := cfg.db.GetUserByID(r.Context(), followeeID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusNotFound, "User not found", err)
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Failed to get user", err)
+		return
+	}
+
+	err = cfg.db.CreateFollow(r.Context(), database.CreateFollowParams{
+		FollowerID: userID,
+		FolloweeID: followeeID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to follow user", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handlerFollowDelete(w http.ResponseWriter, r *http.Request) {
+	followeeID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID", err)
+		return
+	}
+
+	claims, err := cfg.authenticate(r, auth.ScopeChirpsWrite)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+	userID := claims.UserID
+
+	err = cfg.db.DeleteFollow(r.Context(), database.DeleteFollowParams{
+		FollowerID: userID,
+		FolloweeID: followeeID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to unfollow user", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handlerFollowersGet(w http.ResponseWriter, r *http.Request) {
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID", err)
+		return
+	}
+
+	page, err := parseNewestFirstPageParams(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	rows, err := cfg.db.ListFollowers(r.Context(), database.ListFollowersParams{
+		FolloweeID:      userID,
+		CursorCreatedAt: page.Cursor.CreatedAt,
+		CursorID:        page.Cursor.ID,
+		Limit:           page.Limit + 1,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to get followers", err)
+		return
+	}
+
+	follows := make([]Follow, 0, len(rows))
+	for _, row := range rows {
+		follows = append(follows, Follow{
+			UserID:     row.FollowerID,
+			FollowedAt: row.CreatedAt,
+		})
+	}
+	respondWithFollowPage(w, r, page, follows)
+}
+
+func (cfg *apiConfig) handlerFollowingGet(w http.ResponseWriter, r *http.Request) {
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID", err)
+		return
+	}
+
+	page, err := parseNewestFirstPageParams(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	rows, err := cfg.db.ListFollowing(r.Context(), database.ListFollowingParams{
+		FollowerID:      userID,
+		CursorCreatedAt: page.Cursor.CreatedAt,
+		CursorID:        page.Cursor.ID,
+		Limit:           page.Limit + 1,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to get followed users", err)
+		return
+	}
+
+	follows := make([]Follow, 0, len(rows))
+	for _, row := range rows {
+		follows = append(follows, Follow{
+			UserID:     row.FolloweeID,
+			FollowedAt: row.CreatedAt,
+		})
+	}
+	respondWithFollowPage(w, r, page, follows)
+}
+
+func respondWithFollowPage(w http.ResponseWriter, r *http.Request, page pageParams, follows []Follow) {
+	if len(follows) > int(page.Limit) {
+		follows = follows[:page.Limit]
+		last := follows[len(follows)-1]
+		setNextPageLink(w, r, page, pageCursor{CreatedAt: last.FollowedAt, ID: last.UserID})
+	}
+	respondWithJSON(w, http.StatusOK, follows)
+}
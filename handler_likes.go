@@ -0,0 +1,122 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/Skorgum/Chirpy/internal/auth"
+	"github.com/Skorgum/Chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+type Like struct {
+	UserID    uuid.UUID `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (cfg *apiConfig) handlerLikeCreate(w http.ResponseWriter, r *http.Request) {
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid chirp ID", err)
+		return
+	}
+
+	claims, err := cfg.authenticate(r, auth.ScopeChirpsWrite)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+	userID := claims.UserID
+
+	dbChirp, err := cfg.db.GetChirp(r.Context(), chirpID)
+	if err != nil || dbChirp.DeletedAt.Valid {
+		respondWithError(w, http.StatusNotFound, "Chirp not found", err)
+		return
+	}
+
+	// The insert and the counter increment run as one statement, and liking
+	// twice is a no-op, so like_count can't drift under concurrent requests.
+	err = cfg.db.CreateLike(r.Context(), database.CreateLikeParams{
+		UserID:  userID,
+		ChirpID: chirpID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to like chirp", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handlerLikeDelete(w http.ResponseWriter, r *http.Request) {
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid chirp ID", err)
+		return
+	}
+
+	claims, err := cfg.authenticate(r, auth.ScopeChirpsWrite)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+	userID := claims.UserID
+
+	err = cfg.db.DeleteLike(r.Context(), database.DeleteLikeParams{
+		UserID:  userID,
+		ChirpID: chirpID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to unlike chirp", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handlerLikesGet(w http.ResponseWriter, r *http.Request) {
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid chirp ID", err)
+		return
+	}
+
+	page, err := parseNewestFirstPageParams(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	dbChirp, err := cfg.db.GetChirp(r.Context(), chirpID)
+	if err != nil || dbChirp.DeletedAt.Valid {
+		respondWithError(w, http.StatusNotFound, "Chirp not found", err)
+		return
+	}
+
+	rows, err := cfg.db.ListChirpLikes(r.Context(), database.ListChirpLikesParams{
+		ChirpID:         chirpID,
+		CursorCreatedAt: page.Cursor.CreatedAt,
+		CursorID:        page.Cursor.ID,
+		Limit:           page.Limit + 1,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to get likes", err)
+		return
+	}
+
+	if len(rows) > int(page.Limit) {
+		rows = rows[:page.Limit]
+		last := rows[len(rows)-1]
+		setNextPageLink(w, r, page, pageCursor{CreatedAt: last.CreatedAt, ID: last.UserID})
+	}
+
+	likes := make([]Like, 0, len(rows))
+	for _, row := range rows {
+		likes = append(likes, Like{
+			UserID:    row.UserID,
+			CreatedAt: row.CreatedAt,
+		})
+	}
+
+	respondWithJSON(w, http.StatusOK, likes)
+}
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"time"
 
@@ -10,6 +12,23 @@ import (
 	"github.com/google/uuid"
 )
 
+const mfaChallengeTTL = 5 * time.Minute
+
+type loginResponse struct {
+	ID           uuid.UUID `json:"id"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+	Email        string    `json:"email"`
+	IsChirpyRed  bool      `json:"is_chirpy_red"`
+	Token        string    `json:"token"`
+	RefreshToken string    `json:"refresh_token,omitempty"`
+}
+
+// handlerLogin checks the password. Failed attempts are counted per email
+// and per client IP, and too many of them lock further attempts out for a
+// while (see login_throttle.go). Users without two-factor authentication
+// get their tokens straight away; the others get an MFA challenge token to
+// redeem at POST /api/login/mfa along with a code.
 func (cfg *apiConfig) handlerLogin(w http.ResponseWriter, r *http.Request) {
 	type parameters struct {
 		Email            string `json:"email"`
@@ -25,56 +44,108 @@ func (cfg *apiConfig) handlerLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	expiresIn := time.Hour
-
+	// Unknown emails are checked against a dummy hash so they take as long
+	// as a wrong password and can't be told apart by timing.
+	hash := cfg.dummyPasswordHash
 	user, err := cfg.db.GetUserByEmail(r.Context(), params.Email)
+	if err == nil {
+		hash = user.HashedPassword
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't log in", err)
+		return
+	}
+
+	attempt, wait, err := cfg.beginLoginAttempt(r.Context(), loginThrottleKeys(r, params.Email), user.ID)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Invalid email or password", nil)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't log in", err)
+		return
+	}
+	if wait > 0 {
+		respondWithTooManyAttempts(w, wait, "Too many failed login attempts, try again later")
 		return
 	}
 
-	ok, err := auth.CheckPasswordHash(params.Password, user.HashedPassword)
-	if err != nil || !ok {
+	ok, err := auth.CheckPasswordHash(params.Password, hash)
+	if err != nil || !ok || user.ID == uuid.Nil {
+		attempt.failed()
 		respondWithError(w, http.StatusUnauthorized, "Invalid email or password", err)
 		return
 	}
+	if err := cfg.releaseLoginAttempt(r.Context(), attempt); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't log in", err)
+		return
+	}
+
+	cfg.upgradePasswordHash(r.Context(), user, params.Password)
+
+	mfaEnabled, err := cfg.hasTOTP(r.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't log in", err)
+		return
+	}
+	if mfaEnabled {
+		cfg.respondWithMFAChallenge(w, user)
+		return
+	}
 
-	type response struct {
-		ID           uuid.UUID `json:"id"`
-		CreatedAt    time.Time `json:"created_at"`
-		UpdatedAt    time.Time `json:"updated_at"`
-		Email        string    `json:"email"`
-		IsChirpyRed  bool      `json:"is_chirpy_red"`
-		Token        string    `json:"token"`
-		RefreshToken string    `json:"refresh_token,omitempty"`
+	if err := cfg.clearLoginFailures(r.Context(), user.Email); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't log in", err)
+		return
 	}
 
-	accessToken, err := auth.MakeJWT(user.ID, cfg.jwtSecret, expiresIn)
+	res, err := cfg.issueSession(r, user, params.ExpiresInSeconds)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Failed to create token", err)
 		return
 	}
+	respondWithJSON(w, http.StatusOK, res)
+}
 
-	refreshToken, err := auth.MakeRefreshToken()
+// respondWithMFAChallenge ends the first step of a login for a user with
+// two-factor authentication: instead of tokens they get an MFA challenge
+// token to redeem at POST /api/login/mfa along with a code.
+func (cfg *apiConfig) respondWithMFAChallenge(w http.ResponseWriter, user database.User) {
+	type mfaResponse struct {
+		MFARequired bool   `json:"mfa_required"`
+		MFAToken    string `json:"mfa_token"`
+	}
+
+	challenge, err := auth.MakeJWT(auth.Claims{
+		UserID: user.ID,
+		Type:   auth.TokenTypeMFAChallenge,
+	}, cfg.jwtKeys, mfaChallengeTTL)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Failed to create token", err)
 		return
 	}
 
-	now := time.Now().UTC()
-	expiresAt := now.Add(60 * 24 * time.Hour) // Refresh token valid for 60 days
+	respondWithJSON(w, http.StatusOK, mfaResponse{
+		MFARequired: true,
+		MFAToken:    challenge,
+	})
+}
+
+// issueSession starts a new session for a fully authenticated user and
+// returns its access and refresh tokens.
+func (cfg *apiConfig) issueSession(r *http.Request, user database.User, expiresInSeconds int) (loginResponse, error) {
+	lifetimes := cfg.tokenLifetimesFor(user)
+	sessionID := uuid.New()
 
-	_, err = cfg.db.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
-		Token:     refreshToken,
+	accessToken, err := auth.MakeJWT(auth.Claims{
 		UserID:    user.ID,
-		ExpiresAt: expiresAt,
-	})
+		SessionID: sessionID,
+		Scopes:    auth.AllScopes,
+	}, cfg.jwtKeys, lifetimes.AccessTTLFor(expiresInSeconds))
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Failed to create token", err)
-		return
+		return loginResponse{}, err
+	}
+
+	refreshToken, err := cfg.createRefreshToken(r, cfg.db, user.ID, sessionID, lifetimes.RefreshTTL)
+	if err != nil {
+		return loginResponse{}, err
 	}
 
-	res := response{
+	return loginResponse{
 		ID:           user.ID,
 		CreatedAt:    user.CreatedAt,
 		UpdatedAt:    user.UpdatedAt,
@@ -82,6 +153,5 @@ func (cfg *apiConfig) handlerLogin(w http.ResponseWriter, r *http.Request) {
 		IsChirpyRed:  user.IsChirpyRed,
 		Token:        accessToken,
 		RefreshToken: refreshToken,
-	}
-	respondWithJSON(w, http.StatusOK, res)
+	}, nil
 }
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Skorgum/Chirpy/internal/auth"
+	"github.com/Skorgum/Chirpy/internal/database"
+	"github.com/Skorgum/Chirpy/internal/mail"
+	"github.com/Skorgum/Chirpy/internal/oidc"
+	"github.com/google/uuid"
+)
+
+const (
+	oidcLoginTTL    = 10 * time.Minute
+	oidcLoginCookie = "chirpy_oidc_login"
+)
+
+var (
+	errSSOEmailMissing = errors.New("identity provider did not share an email address")
+	errSSOEmailInUse   = errors.New("an account with this email exists and it or the provider has not verified the address")
+)
+
+// oidcProviderFromEnv configures login through an external OpenID Connect
+// provider from OIDC_ISSUER, OIDC_CLIENT_ID, OIDC_CLIENT_SECRET and
+// OIDC_REDIRECT_URL, the front end page the provider returns to. OIDC_SCOPES
+// overrides the default "openid email profile". It returns nil if
+// OIDC_ISSUER is unset.
+func oidcProviderFromEnv() (*oidc.Provider, error) {
+	issuer := os.Getenv("OIDC_ISSUER")
+	if issuer == "" {
+		return nil, nil
+	}
+	config := oidc.Config{
+		Issuer:       issuer,
+		ClientID:     os.Getenv("OIDC_CLIENT_ID"),
+		ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+		RedirectURL:  os.Getenv("OIDC_REDIRECT_URL"),
+		Scopes:       strings.Fields(os.Getenv("OIDC_SCOPES")),
+	}
+	if config.ClientID == "" || config.RedirectURL == "" {
+		return nil, errors.New("OIDC_CLIENT_ID and OIDC_REDIRECT_URL are required with OIDC_ISSUER")
+	}
+	return oidc.NewProvider(config, &http.Client{Timeout: 10 * time.Second}), nil
+}
+
+// handlerOIDCLoginStart begins a login at the external provider. It returns
+// the URL to send the browser to and sets a cookie that ties the login to
+// this browser, so a callback from someone else's login is refused.
+func (cfg *apiConfig) handlerOIDCLoginStart(w http.ResponseWriter, r *http.Request) {
+	if cfg.oidcProvider == nil {
+		respondWithError(w, http.StatusNotFound, "Single sign-on is not configured", nil)
+		return
+	}
+
+	var secrets [4]string
+	for i := range secrets {
+		token, err := auth.MakeToken()
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't start login", err)
+			return
+		}
+		secrets[i] = token
+	}
+	state, nonce, verifier, browser := secrets[0], secrets[1], secrets[2], secrets[3]
+
+	if err := cfg.db.DeleteExpiredOIDCLoginStates(r.Context()); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't start login", err)
+		return
+	}
+	expiresAt := time.Now().UTC().Add(oidcLoginTTL)
+	err := cfg.db.CreateOIDCLoginState(r.Context(), database.CreateOIDCLoginStateParams{
+		StateHash:    auth.HashToken(state),
+		BrowserHash:  auth.HashToken(browser),
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    expiresAt,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't start login", err)
+		return
+	}
+
+	authURL, err := cfg.oidcProvider.AuthCodeURL(r.Context(), state, nonce, auth.PKCEChallenge(verifier))
+	if err != nil {
+		respondWithError(w, http.StatusBadGateway, "Couldn't reach the identity provider", err)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcLoginCookie,
+		Value:    browser,
+		Path:     "/api/login/oidc",
+		Expires:  expiresAt,
+		HttpOnly: true,
+		Secure:   cfg.platform != "dev",
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	type response struct {
+		AuthorizationURL string `json:"authorization_url"`
+	}
+	respondWithJSON(w, http.StatusOK, response{AuthorizationURL: authURL})
+}
+
+// handlerOIDCLoginCallback finishes a login at the external provider. The
+// front end page at OIDC_REDIRECT_URL posts the code and state it was sent
+// back with; the response is the same as handlerLogin's, including the MFA
+// challenge for users with two-factor authentication, which the provider
+// doesn't stand in for.
+func (cfg *apiConfig) handlerOIDCLoginCallback(w http.ResponseWriter, r *http.Request) {
+	if cfg.oidcProvider == nil {
+		respondWithError(w, http.StatusNotFound, "Single sign-on is not configured", nil)
+		return
+	}
+
+	type parameters struct {
+		Code             string `json:"code"`
+		State            string `json:"state"`
+		ExpiresInSeconds int    `json:"expires_in_seconds"`
+	}
+
+	var params parameters
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+	if params.Code == "" || params.State == "" {
+		respondWithError(w, http.StatusBadRequest, "code and state are required", nil)
+		return
+	}
+
+	// The state is consumed whatever happens next, so it can't be retried.
+	login, err := cfg.db.ConsumeOIDCLoginState(r.Context(), auth.HashToken(params.State))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusBadRequest, "Invalid or expired login", err)
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Couldn't log in", err)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcLoginCookie,
+		Path:     "/api/login/oidc",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   cfg.platform != "dev",
+		SameSite: http.SameSiteLaxMode,
+	})
+	cookie, err := r.Cookie(oidcLoginCookie)
+	if err != nil || subtle.ConstantTimeCompare([]byte(auth.HashToken(cookie.Value)), []byte(login.BrowserHash)) != 1 {
+		respondWithError(w, http.StatusBadRequest, "Invalid or expired login", nil)
+		return
+	}
+
+	identity, err := cfg.oidcProvider.Exchange(r.Context(), params.Code, login.CodeVerifier, login.Nonce)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't verify your identity", err)
+		return
+	}
+
+	user, linked, err := cfg.userForExternalIdentity(r.Context(), identity)
+	if err != nil {
+		switch {
+		case errors.Is(err, errSSOEmailMissing):
+			respondWithError(w, http.StatusBadRequest, "The identity provider did not share your email address", err)
+		case errors.Is(err, errSSOEmailInUse):
+			respondWithError(w, http.StatusConflict, "An account with this email already exists; log in with your password or reset it", err)
+		default:
+			respondWithError(w, http.StatusInternalServerError, "Couldn't log in", err)
+		}
+		return
+	}
+
+	if linked {
+		logSecurityEvent("external_identity_linked", user.ID, "%s subject %q linked by verified email", identity.Issuer, identity.Subject)
+		if err := cfg.sendIdentityLinkedEmail(r.Context(), user.Email, identity.Issuer); err != nil {
+			log.Printf("Failed to send identity linked email to user %s: %v", user.ID, err)
+		}
+	}
+
+	mfaEnabled, err := cfg.hasTOTP(r.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't log in", err)
+		return
+	}
+	if mfaEnabled {
+		cfg.respondWithMFAChallenge(w, user)
+		return
+	}
+
+	res, err := cfg.issueSession(r, user, params.ExpiresInSeconds)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to create token", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, res)
+}
+
+// userForExternalIdentity returns the user an external identity belongs to.
+// An identity seen for the first time is linked to the account with the
+// same email address only if both the provider and the account have
+// verified that address (see oidc.CanLinkByEmail). Linking also wipes the
+// account's other credentials, so nobody who had them before keeps access
+// alongside the identity's owner. linked reports whether that happened.
+// Without such an account a new user is created, with a random password
+// they can replace through a password reset.
+func (cfg *apiConfig) userForExternalIdentity(ctx context.Context, identity oidc.Identity) (user database.User, linked bool, err error) {
+	tx, err := cfg.dbConn.BeginTx(ctx, nil)
+	if err != nil {
+		return database.User{}, false, err
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	existing, err := qtx.GetExternalIdentity(ctx, database.GetExternalIdentityParams{
+		Issuer:  identity.Issuer,
+		Subject: identity.Subject,
+	})
+	if err == nil {
+		if err := qtx.TouchExternalIdentity(ctx, database.TouchExternalIdentityParams{
+			ID:    existing.ID,
+			Email: identity.Email,
+		}); err != nil {
+			return database.User{}, false, err
+		}
+		user, err := qtx.GetUserByID(ctx, existing.UserID)
+		if err != nil {
+			return database.User{}, false, err
+		}
+		return user, false, tx.Commit()
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return database.User{}, false, err
+	}
+
+	if identity.Email == "" {
+		return database.User{}, false, errSSOEmailMissing
+	}
+
+	user, err = qtx.GetUserByEmail(ctx, identity.Email)
+	switch {
+	case err == nil:
+		if !oidc.CanLinkByEmail(identity, user.EmailVerifiedAt.Valid) {
+			return database.User{}, false, errSSOEmailInUse
+		}
+		user, err = cfg.resetCredentials(ctx, qtx, user.ID)
+		if err != nil {
+			return database.User{}, false, err
+		}
+		linked = true
+	case errors.Is(err, sql.ErrNoRows):
+		password, err := auth.MakeToken()
+		if err != nil {
+			return database.User{}, false, err
+		}
+		hashedPassword, err := auth.HashPassword(password, cfg.passwordParams)
+		if err != nil {
+			return database.User{}, false, err
+		}
+		user, err = qtx.CreateUser(ctx, database.CreateUserParams{
+			Email:          identity.Email,
+			HashedPassword: hashedPassword,
+		})
+		if err != nil {
+			return database.User{}, false, err
+		}
+	default:
+		return database.User{}, false, err
+	}
+
+	if identity.EmailVerified && !user.EmailVerifiedAt.Valid {
+		user, err = qtx.MarkUserEmailVerified(ctx, user.ID)
+		if err != nil {
+			return database.User{}, false, err
+		}
+	}
+
+	_, err = qtx.CreateExternalIdentity(ctx, database.CreateExternalIdentityParams{
+		UserID:  user.ID,
+		Issuer:  identity.Issuer,
+		Subject: identity.Subject,
+		Email:   identity.Email,
+	})
+	if err != nil {
+		return database.User{}, false, err
+	}
+
+	return user, linked, tx.Commit()
+}
+
+// resetCredentials replaces the user's password with a random one and
+// revokes everything else that signs them in: refresh tokens, personal
+// access tokens, two-factor authentication and any pending password reset
+// or email change. Access tokens already issued run out on their own.
+func (cfg *apiConfig) resetCredentials(ctx context.Context, qtx *database.Queries, userID uuid.UUID) (database.User, error) {
+	password, err := auth.MakeToken()
+	if err != nil {
+		return database.User{}, err
+	}
+	hashedPassword, err := auth.HashPassword(password, cfg.passwordParams)
+	if err != nil {
+		return database.User{}, err
+	}
+	user, err := qtx.UpdateUserPassword(ctx, database.UpdateUserPasswordParams{
+		ID:             userID,
+		HashedPassword: hashedPassword,
+	})
+	if err != nil {
+		return database.User{}, err
+	}
+
+	for _, revoke := range []func(context.Context, uuid.UUID) error{
+		qtx.RevokeUserRefreshTokens,
+		qtx.RevokeUserPersonalAccessTokens,
+		qtx.DeleteUserTOTP,
+		qtx.DeleteRecoveryCodes,
+		qtx.DeletePendingPasswordResetTokens,
+		qtx.DeletePendingEmailChangeTokens,
+	} {
+		if err := revoke(ctx, userID); err != nil {
+			return database.User{}, err
+		}
+	}
+	return user, nil
+}
+
+func (cfg *apiConfig) sendIdentityLinkedEmail(ctx context.Context, to, issuer string) error {
+	return cfg.mailer.Send(ctx, mail.Message{
+		To:      to,
+		Subject: "A new sign-in method was added to your Chirpy account",
+		Body: fmt.Sprintf("Your Chirpy account can now be signed in to through %s, "+
+			"because it confirmed that this email address belongs to you there.\n\n"+
+			"To keep the account yours alone, every other way of signing in to it has been "+
+			"removed: your password was replaced, all sessions and personal access tokens "+
+			"were revoked, and two-factor authentication was turned off. Reset your password "+
+			"and set up two-factor authentication again if you want to use them.\n\n"+
+			"If this wasn't you, contact support.\n", issuer),
+	})
+}
@@ -0,0 +1,428 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/Skorgum/Chirpy/internal/auth"
+	"github.com/Skorgum/Chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const totpIssuer = "Chirpy"
+
+// hasTOTP reports whether the user has finished setting up two-factor
+// authentication.
+func (cfg *apiConfig) hasTOTP(ctx context.Context, userID uuid.UUID) (bool, error) {
+	totp, err := cfg.db.GetUserTOTP(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return totp.ConfirmedAt.Valid, nil
+}
+
+// checkTOTP validates code for the user and marks its time step as used so
+// the same code can't be replayed.
+func (cfg *apiConfig) checkTOTP(ctx context.Context, q *database.Queries, totp database.UserTotp, code string) (bool, error) {
+	step, ok := auth.ValidateTOTP(totp.Secret, code, cfg.clock())
+	if !ok {
+		return false, nil
+	}
+	used, err := q.UseTOTPStep(ctx, database.UseTOTPStepParams{
+		UserID:       totp.UserID,
+		LastUsedStep: step,
+	})
+	if err != nil {
+		return false, err
+	}
+	return used == 1, nil
+}
+
+// replaceRecoveryCodes issues a fresh set of recovery codes, invalidating any
+// the user had before.
+func replaceRecoveryCodes(ctx context.Context, q *database.Queries, userID uuid.UUID) ([]string, error) {
+	codes, err := auth.GenerateRecoveryCodes(auth.RecoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+	if err := q.DeleteRecoveryCodes(ctx, userID); err != nil {
+		return nil, err
+	}
+	for _, code := range codes {
+		err := q.CreateRecoveryCode(ctx, database.CreateRecoveryCodeParams{
+			UserID:   userID,
+			CodeHash: auth.HashRecoveryCode(code),
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return codes, nil
+}
+
+func (cfg *apiConfig) handlerTOTPEnroll(w http.ResponseWriter, r *http.Request) {
+	claims, err := cfg.authenticate(r, auth.ScopeAccount)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	type response struct {
+		Secret string `json:"secret"`
+		URI    string `json:"otpauth_uri"`
+	}
+
+	user, err := cfg.db.GetUserByID(r.Context(), claims.UserID)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized", err)
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't start enrolment", err)
+		return
+	}
+
+	started, err := cfg.db.StartTOTPEnrolment(r.Context(), database.StartTOTPEnrolmentParams{
+		UserID: user.ID,
+		Secret: secret,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't start enrolment", err)
+		return
+	}
+	if started == 0 {
+		respondWithError(w, http.StatusConflict, "Two-factor authentication is already enabled", nil)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response{
+		Secret: secret,
+		URI:    auth.TOTPURI(secret, totpIssuer, user.Email),
+	})
+}
+
+// handlerTOTPConfirm turns on two-factor authentication once the user has
+// shown their authenticator produces valid codes, and hands out the
+// recovery codes. They are only ever shown here.
+func (cfg *apiConfig) handlerTOTPConfirm(w http.ResponseWriter, r *http.Request) {
+	claims, err := cfg.authenticate(r, auth.ScopeAccount)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	type parameters struct {
+		Code string `json:"code"`
+	}
+	type response struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+
+	var params parameters
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't confirm enrolment", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	totp, err := qtx.GetUserTOTP(r.Context(), claims.UserID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusNotFound, "No enrolment in progress", err)
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Couldn't confirm enrolment", err)
+		return
+	}
+	if totp.ConfirmedAt.Valid {
+		respondWithError(w, http.StatusConflict, "Two-factor authentication is already enabled", nil)
+		return
+	}
+
+	step, ok := auth.ValidateTOTP(totp.Secret, params.Code, cfg.clock())
+	if !ok {
+		respondWithError(w, http.StatusBadRequest, "Invalid code", nil)
+		return
+	}
+
+	confirmed, err := qtx.ConfirmTOTPEnrolment(r.Context(), database.ConfirmTOTPEnrolmentParams{
+		UserID:       claims.UserID,
+		LastUsedStep: step,
+	})
+	if err != nil || confirmed != 1 {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't confirm enrolment", err)
+		return
+	}
+
+	codes, err := replaceRecoveryCodes(r.Context(), qtx, claims.UserID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't confirm enrolment", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't confirm enrolment", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response{RecoveryCodes: codes})
+}
+
+// handlerTOTPDelete turns two-factor authentication off. The password is
+// asked for again so a stolen access token alone can't do it.
+func (cfg *apiConfig) handlerTOTPDelete(w http.ResponseWriter, r *http.Request) {
+	claims, err := cfg.authenticate(r, auth.ScopeAccount)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	type parameters struct {
+		Password string `json:"password"`
+	}
+
+	var params parameters
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+
+	user, err := cfg.db.GetUserByID(r.Context(), claims.UserID)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized", err)
+		return
+	}
+
+	ok, err := auth.CheckPasswordHash(params.Password, user.HashedPassword)
+	if err != nil || !ok {
+		respondWithError(w, http.StatusForbidden, "Password is incorrect", err)
+		return
+	}
+
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't disable two-factor authentication", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	if err := qtx.DeleteUserTOTP(r.Context(), user.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't disable two-factor authentication", err)
+		return
+	}
+	if err := qtx.DeleteRecoveryCodes(r.Context(), user.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't disable two-factor authentication", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't disable two-factor authentication", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handlerRecoveryCodesRegenerate(w http.ResponseWriter, r *http.Request) {
+	claims, err := cfg.authenticate(r, auth.ScopeAccount)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	type parameters struct {
+		Code string `json:"code"`
+	}
+	type response struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+
+	var params parameters
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create recovery codes", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	totp, err := qtx.GetUserTOTP(r.Context(), claims.UserID)
+	if err != nil || !totp.ConfirmedAt.Valid {
+		respondWithError(w, http.StatusNotFound, "Two-factor authentication is not enabled", err)
+		return
+	}
+
+	ok, err := cfg.checkTOTP(r.Context(), qtx, totp, params.Code)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create recovery codes", err)
+		return
+	}
+	if !ok {
+		respondWithError(w, http.StatusBadRequest, "Invalid code", nil)
+		return
+	}
+
+	codes, err := replaceRecoveryCodes(r.Context(), qtx, claims.UserID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create recovery codes", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create recovery codes", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response{RecoveryCodes: codes})
+}
+
+// handlerLoginMFA completes a login started by handlerLogin. It takes the
+// MFA challenge token and either a current TOTP code or an unused recovery
+// code. The challenge token can only be redeemed once, and wrong codes count
+// towards the same lockout as wrong passwords.
+func (cfg *apiConfig) handlerLoginMFA(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		MFAToken         string `json:"mfa_token"`
+		Code             string `json:"code"`
+		RecoveryCode     string `json:"recovery_code"`
+		ExpiresInSeconds int    `json:"expires_in_seconds"`
+	}
+
+	var params parameters
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+
+	challenge, err := auth.ValidateJWT(params.MFAToken, cfg.jwtKeys, auth.TokenTypeMFAChallenge)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Invalid or expired MFA token", err)
+		return
+	}
+	redeemed, err := cfg.db.IsAccessTokenRevoked(r.Context(), challenge.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't log in", err)
+		return
+	}
+	if redeemed {
+		respondWithError(w, http.StatusUnauthorized, "Invalid or expired MFA token", nil)
+		return
+	}
+
+	user, err := cfg.db.GetUserByID(r.Context(), challenge.UserID)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Invalid or expired MFA token", err)
+		return
+	}
+
+	if params.Code == "" && params.RecoveryCode == "" {
+		respondWithError(w, http.StatusBadRequest, "code or recovery_code is required", nil)
+		return
+	}
+
+	attempt, wait, err := cfg.beginLoginAttempt(r.Context(), loginThrottleKeys(r, user.Email), user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't log in", err)
+		return
+	}
+	if wait > 0 {
+		respondWithTooManyAttempts(w, wait, "Too many failed login attempts, try again later")
+		return
+	}
+
+	ok, err := cfg.redeemLoginCode(r.Context(), challenge.UserID, params.Code, params.RecoveryCode)
+	if errors.Is(err, errMFANotEnabled) {
+		attempt.failed()
+		respondWithError(w, http.StatusUnauthorized, "Invalid or expired MFA token", err)
+		return
+	}
+	if err != nil {
+		cfg.abandonLoginAttempt(r.Context(), attempt)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't log in", err)
+		return
+	}
+	if !ok {
+		attempt.failed()
+		respondWithError(w, http.StatusUnauthorized, "Invalid code", nil)
+		return
+	}
+	if err := cfg.releaseLoginAttempt(r.Context(), attempt); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't log in", err)
+		return
+	}
+
+	if err := cfg.revokeAccessToken(r.Context(), challenge); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't log in", err)
+		return
+	}
+	if err := cfg.clearLoginFailures(r.Context(), user.Email); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't log in", err)
+		return
+	}
+
+	res, err := cfg.issueSession(r, user, params.ExpiresInSeconds)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to create token", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, res)
+}
+
+var errMFANotEnabled = errors.New("two-factor authentication is not enabled")
+
+// redeemLoginCode checks a TOTP code, or if code is empty a recovery code,
+// for userID and uses it up. It returns errMFANotEnabled if the user has no
+// confirmed TOTP, and any other error is the server's.
+func (cfg *apiConfig) redeemLoginCode(ctx context.Context, userID uuid.UUID, code, recoveryCode string) (bool, error) {
+	tx, err := cfg.dbConn.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	totp, err := qtx.GetUserTOTP(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !totp.ConfirmedAt.Valid) {
+		return false, errMFANotEnabled
+	}
+	if err != nil {
+		return false, err
+	}
+
+	var ok bool
+	if code != "" {
+		ok, err = cfg.checkTOTP(ctx, qtx, totp, code)
+	} else {
+		var used int64
+		used, err = qtx.UseRecoveryCode(ctx, database.UseRecoveryCodeParams{
+			UserID:   userID,
+			CodeHash: auth.HashRecoveryCode(recoveryCode),
+		})
+		ok = used == 1
+	}
+	if err != nil || !ok {
+		return false, err
+	}
+	return true, tx.Commit()
+}
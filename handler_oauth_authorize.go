@@ -0,0 +1,313 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/Skorgum/Chirpy/internal/auth"
+	"github.com/Skorgum/Chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const oauthCodeTTL = 5 * time.Minute
+
+// authorizationRequest holds the parameters of an OAuth 2.0 authorization
+// request (RFC 6749 section 4.1.1, with PKCE and the OpenID Connect nonce).
+type authorizationRequest struct {
+	ResponseType        string `json:"response_type"`
+	ClientID            string `json:"client_id"`
+	RedirectURI         string `json:"redirect_uri"`
+	Scope               string `json:"scope"`
+	State               string `json:"state"`
+	Nonce               string `json:"nonce"`
+	CodeChallenge       string `json:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method"`
+}
+
+func authorizationRequestFromQuery(q url.Values) authorizationRequest {
+	return authorizationRequest{
+		ResponseType:        q.Get("response_type"),
+		ClientID:            q.Get("client_id"),
+		RedirectURI:         q.Get("redirect_uri"),
+		Scope:               q.Get("scope"),
+		State:               q.Get("state"),
+		Nonce:               q.Get("nonce"),
+		CodeChallenge:       q.Get("code_challenge"),
+		CodeChallengeMethod: q.Get("code_challenge_method"),
+	}
+}
+
+// authorization is a checked authorization request.
+type authorization struct {
+	Client      database.OauthClient
+	RedirectURI string
+	Scopes      []string
+}
+
+// errUntrustedRedirect means the client or redirect URI couldn't be
+// confirmed, so errors can't be sent back to the client and are shown to
+// the user instead.
+var errUntrustedRedirect = errors.New("unknown client or redirect URI")
+
+// checkAuthorizationRequest looks up the client and validates req. If the
+// client and redirect URI check out but the rest of the request doesn't, it
+// returns the redirect that reports the error to the client.
+func (cfg *apiConfig) checkAuthorizationRequest(r *http.Request, req authorizationRequest) (authorization, string, error) {
+	clientID, err := uuid.Parse(req.ClientID)
+	if err != nil {
+		return authorization{}, "", errUntrustedRedirect
+	}
+	client, err := cfg.db.GetOAuthClient(r.Context(), clientID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return authorization{}, "", errUntrustedRedirect
+		}
+		return authorization{}, "", err
+	}
+
+	redirectURI := req.RedirectURI
+	if redirectURI == "" && len(client.RedirectURIs) == 1 {
+		redirectURI = client.RedirectURIs[0]
+	}
+	if !slices.Contains(client.RedirectURIs, redirectURI) {
+		return authorization{}, "", errUntrustedRedirect
+	}
+	a := authorization{Client: client, RedirectURI: redirectURI}
+
+	fail := func(code, description string) (authorization, string, error) {
+		return a, oauthRedirect(redirectURI, url.Values{
+			"error":             {code},
+			"error_description": {description},
+			"state":             {req.State},
+		}), nil
+	}
+
+	if req.ResponseType != "code" {
+		return fail("unsupported_response_type", "Only the authorization code flow is supported")
+	}
+
+	requested := auth.ParseScope(req.Scope)
+	if len(requested) == 0 {
+		return fail("invalid_scope", "scope is required")
+	}
+	a.Scopes, err = auth.ValidateOAuthScopes(requested, client.Scopes)
+	if err != nil {
+		return fail("invalid_scope", err.Error())
+	}
+	if slices.Contains(a.Scopes, auth.ScopeOpenID) && !cfg.oidcEnabled() {
+		return fail("invalid_scope", "OpenID Connect is not enabled")
+	}
+
+	if req.CodeChallengeMethod != auth.PKCEMethodS256 {
+		return fail("invalid_request", "code_challenge_method must be S256")
+	}
+	if err := auth.ValidatePKCEChallenge(req.CodeChallenge); err != nil {
+		return fail("invalid_request", err.Error())
+	}
+
+	return a, "", nil
+}
+
+// oauthRedirect adds params to a redirect URI, leaving out empty values.
+func oauthRedirect(redirectURI string, params url.Values) string {
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		return redirectURI
+	}
+	q := u.Query()
+	for k, vs := range params {
+		for _, v := range vs {
+			if v != "" {
+				q.Add(k, v)
+			}
+		}
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+type authorizeRedirect struct {
+	RedirectTo string `json:"redirect_to"`
+}
+
+// handlerOAuthAuthorizeGet is called by the consent page with the query
+// string of the authorization request it was sent. It describes the request
+// so the page can ask the user, or says where to send the browser if the
+// request is invalid.
+func (cfg *apiConfig) handlerOAuthAuthorizeGet(w http.ResponseWriter, r *http.Request) {
+	claims, err := cfg.authenticate(r, auth.ScopeAccount)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	a, redirect, err := cfg.checkAuthorizationRequest(r, authorizationRequestFromQuery(r.URL.Query()))
+	if err != nil {
+		if errors.Is(err, errUntrustedRedirect) {
+			respondWithError(w, http.StatusBadRequest, "Invalid client_id or redirect_uri", err)
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check authorization request", err)
+		return
+	}
+	if redirect != "" {
+		respondWithJSON(w, http.StatusOK, authorizeRedirect{RedirectTo: redirect})
+		return
+	}
+
+	type response struct {
+		ClientID        uuid.UUID `json:"client_id"`
+		ClientName      string    `json:"client_name"`
+		Scopes          []string  `json:"scopes"`
+		ConsentRequired bool      `json:"consent_required"`
+	}
+
+	consented, err := cfg.hasOAuthConsent(r, claims.UserID, a)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check authorization request", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response{
+		ClientID:        a.Client.ID,
+		ClientName:      a.Client.Name,
+		Scopes:          a.Scopes,
+		ConsentRequired: !consented,
+	})
+}
+
+// hasOAuthConsent reports whether the user already agreed to every scope
+// in a.
+func (cfg *apiConfig) hasOAuthConsent(r *http.Request, userID uuid.UUID, a authorization) (bool, error) {
+	consent, err := cfg.db.GetOAuthConsent(r.Context(), database.GetOAuthConsentParams{
+		UserID:   userID,
+		ClientID: a.Client.ID,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+	for _, scope := range a.Scopes {
+		if !slices.Contains(consent.Scopes, scope) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// handlerOAuthAuthorize records the user's answer to an authorization
+// request. If they approve, their consent is stored and an authorization
+// code is issued; either way the response says where to send the browser.
+func (cfg *apiConfig) handlerOAuthAuthorize(w http.ResponseWriter, r *http.Request) {
+	claims, err := cfg.authenticate(r, auth.ScopeAccount)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	type parameters struct {
+		authorizationRequest
+		Approve bool `json:"approve"`
+	}
+
+	var params parameters
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+
+	a, redirect, err := cfg.checkAuthorizationRequest(r, params.authorizationRequest)
+	if err != nil {
+		if errors.Is(err, errUntrustedRedirect) {
+			respondWithError(w, http.StatusBadRequest, "Invalid client_id or redirect_uri", err)
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Couldn't authorize", err)
+		return
+	}
+	if redirect != "" {
+		respondWithJSON(w, http.StatusOK, authorizeRedirect{RedirectTo: redirect})
+		return
+	}
+
+	if !params.Approve {
+		respondWithJSON(w, http.StatusOK, authorizeRedirect{RedirectTo: oauthRedirect(a.RedirectURI, url.Values{
+			"error":             {"access_denied"},
+			"error_description": {"The user denied the request"},
+			"state":             {params.State},
+		})})
+		return
+	}
+
+	code, err := auth.MakeToken()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't authorize", err)
+		return
+	}
+
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't authorize", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	scopes := slices.Clone(a.Scopes)
+	consent, err := qtx.GetOAuthConsent(r.Context(), database.GetOAuthConsentParams{
+		UserID:   claims.UserID,
+		ClientID: a.Client.ID,
+	})
+	if err == nil {
+		for _, scope := range consent.Scopes {
+			if !slices.Contains(scopes, scope) {
+				scopes = append(scopes, scope)
+			}
+		}
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't authorize", err)
+		return
+	}
+
+	err = qtx.UpsertOAuthConsent(r.Context(), database.UpsertOAuthConsentParams{
+		UserID:   claims.UserID,
+		ClientID: a.Client.ID,
+		Scopes:   scopes,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't authorize", err)
+		return
+	}
+
+	err = qtx.CreateOAuthAuthorizationCode(r.Context(), database.CreateOAuthAuthorizationCodeParams{
+		CodeHash:      auth.HashToken(code),
+		ClientID:      a.Client.ID,
+		UserID:        claims.UserID,
+		RedirectURI:   a.RedirectURI,
+		Scopes:        a.Scopes,
+		Nonce:         params.Nonce,
+		CodeChallenge: params.CodeChallenge,
+		ExpiresAt:     time.Now().UTC().Add(oauthCodeTTL),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't authorize", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't authorize", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, authorizeRedirect{RedirectTo: oauthRedirect(a.RedirectURI, url.Values{
+		"code":  {code},
+		"state": {params.State},
+	})})
+}
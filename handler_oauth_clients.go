@@ -0,0 +1,259 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Skorgum/Chirpy/internal/auth"
+	"github.com/Skorgum/Chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	maxOAuthClientNameLength   = 100
+	maxOAuthClientRedirectURIs = 10
+)
+
+// OAuthClient describes a registered application. The client secret is
+// only returned once, when the client is created.
+type OAuthClient struct {
+	ID           uuid.UUID `json:"client_id"`
+	Name         string    `json:"name"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	Scopes       []string  `json:"scopes"`
+	Public       bool      `json:"public"`
+	CreatedAt    time.Time `json:"created_at"`
+	ClientSecret string    `json:"client_secret,omitempty"`
+}
+
+func oauthClientFromDB(client database.OauthClient) OAuthClient {
+	return OAuthClient{
+		ID:           client.ID,
+		Name:         client.Name,
+		RedirectURIs: client.RedirectURIs,
+		Scopes:       client.Scopes,
+		Public:       !client.SecretHash.Valid,
+		CreatedAt:    client.CreatedAt,
+	}
+}
+
+// handlerOAuthClientsCreate registers an application that can ask users to
+// sign in with Chirpy. Confidential clients get a secret; public clients,
+// which can't keep one, set "public" and rely on PKCE alone.
+func (cfg *apiConfig) handlerOAuthClientsCreate(w http.ResponseWriter, r *http.Request) {
+	claims, err := cfg.authenticate(r, auth.ScopeAccount)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	type parameters struct {
+		Name         string   `json:"name"`
+		RedirectURIs []string `json:"redirect_uris"`
+		Scopes       []string `json:"scopes"`
+		Public       bool     `json:"public"`
+	}
+
+	var params parameters
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+
+	name := strings.TrimSpace(params.Name)
+	if name == "" || len(name) > maxOAuthClientNameLength {
+		respondWithError(w, http.StatusBadRequest, "Name must be 1-100 characters", nil)
+		return
+	}
+
+	if len(params.RedirectURIs) == 0 || len(params.RedirectURIs) > maxOAuthClientRedirectURIs {
+		respondWithError(w, http.StatusBadRequest, "Between 1 and 10 redirect URIs are required", nil)
+		return
+	}
+	for _, uri := range params.RedirectURIs {
+		if err := auth.ValidateRedirectURI(uri); err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error(), err)
+			return
+		}
+	}
+
+	if len(params.Scopes) == 0 {
+		respondWithError(w, http.StatusBadRequest, "At least one scope is required", nil)
+		return
+	}
+	scopes, err := auth.ValidateOAuthScopes(params.Scopes, auth.OAuthScopes)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	var secret string
+	var secretHash sql.NullString
+	if !params.Public {
+		secret, err = auth.MakeToken()
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't create client", err)
+			return
+		}
+		secretHash = sql.NullString{String: auth.HashToken(secret), Valid: true}
+	}
+
+	client, err := cfg.db.CreateOAuthClient(r.Context(), database.CreateOAuthClientParams{
+		OwnerID:      claims.UserID,
+		Name:         name,
+		SecretHash:   secretHash,
+		RedirectURIs: params.RedirectURIs,
+		Scopes:       scopes,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create client", err)
+		return
+	}
+
+	resp := oauthClientFromDB(client)
+	resp.ClientSecret = secret
+	respondWithJSON(w, http.StatusCreated, resp)
+}
+
+func (cfg *apiConfig) handlerOAuthClientsGet(w http.ResponseWriter, r *http.Request) {
+	claims, err := cfg.authenticate(r, auth.ScopeAccount)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	clients, err := cfg.db.ListOAuthClients(r.Context(), claims.UserID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve clients", err)
+		return
+	}
+
+	resp := make([]OAuthClient, 0, len(clients))
+	for _, client := range clients {
+		resp = append(resp, oauthClientFromDB(client))
+	}
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+// handlerOAuthClientDelete removes a client along with every consent and
+// pending authorization code for it.
+func (cfg *apiConfig) handlerOAuthClientDelete(w http.ResponseWriter, r *http.Request) {
+	clientID, err := uuid.Parse(r.PathValue("clientID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid client ID", err)
+		return
+	}
+
+	claims, err := cfg.authenticate(r, auth.ScopeAccount)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	deleted, err := cfg.db.DeleteOAuthClient(r.Context(), database.DeleteOAuthClientParams{
+		ID:      clientID,
+		OwnerID: claims.UserID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete client", err)
+		return
+	}
+	if deleted == 0 {
+		respondWithError(w, http.StatusNotFound, "Client not found", nil)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// OAuthConsent is an application the user has let sign them in.
+type OAuthConsent struct {
+	ClientID   uuid.UUID `json:"client_id"`
+	ClientName string    `json:"client_name"`
+	Scopes     []string  `json:"scopes"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+func (cfg *apiConfig) handlerOAuthConsentsGet(w http.ResponseWriter, r *http.Request) {
+	claims, err := cfg.authenticate(r, auth.ScopeAccount)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	consents, err := cfg.db.ListOAuthConsents(r.Context(), claims.UserID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve consents", err)
+		return
+	}
+
+	resp := make([]OAuthConsent, 0, len(consents))
+	for _, c := range consents {
+		resp = append(resp, OAuthConsent{
+			ClientID:   c.ClientID,
+			ClientName: c.ClientName,
+			Scopes:     c.Scopes,
+			CreatedAt:  c.CreatedAt,
+			UpdatedAt:  c.UpdatedAt,
+		})
+	}
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+// handlerOAuthConsentDelete withdraws a user's consent for an application.
+// Codes not yet exchanged stop working straight away; access tokens already
+// issued run out on their own.
+func (cfg *apiConfig) handlerOAuthConsentDelete(w http.ResponseWriter, r *http.Request) {
+	clientID, err := uuid.Parse(r.PathValue("clientID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid client ID", err)
+		return
+	}
+
+	claims, err := cfg.authenticate(r, auth.ScopeAccount)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't withdraw consent", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	deleted, err := qtx.DeleteOAuthConsent(r.Context(), database.DeleteOAuthConsentParams{
+		UserID:   claims.UserID,
+		ClientID: clientID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't withdraw consent", err)
+		return
+	}
+	if deleted == 0 {
+		respondWithError(w, http.StatusNotFound, "Consent not found", nil)
+		return
+	}
+
+	err = qtx.DeleteOAuthAuthorizationCodes(r.Context(), database.DeleteOAuthAuthorizationCodesParams{
+		UserID:   claims.UserID,
+		ClientID: clientID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't withdraw consent", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't withdraw consent", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
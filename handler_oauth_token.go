@@ -0,0 +1,183 @@
+package main
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/Skorgum/Chirpy/internal/auth"
+	"github.com/Skorgum/Chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// respondWithOAuthError writes an error in the RFC 6749 section 5.2 form
+// that OAuth client libraries expect from the token endpoint.
+func respondWithOAuthError(w http.ResponseWriter, status int, code, description string, err error) {
+	if err != nil {
+		log.Printf("Error: %v", err)
+	}
+	if status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Basic realm="chirpy"`)
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	respondWithJSON(w, status, struct {
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description,omitempty"`
+	}{
+		Error:            code,
+		ErrorDescription: description,
+	})
+}
+
+// errInvalidClient means a token request's client credentials were
+// missing or wrong.
+var errInvalidClient = errors.New("client authentication failed")
+
+// authenticateOAuthClient identifies the client making a token request from
+// HTTP Basic credentials or client_id and client_secret form values.
+// Confidential clients must present their secret; public clients must not
+// have one to present.
+func (cfg *apiConfig) authenticateOAuthClient(r *http.Request) (database.OauthClient, error) {
+	clientID, secret, basic := r.BasicAuth()
+	if basic {
+		// RFC 6749 section 2.3.1 form-encodes both values.
+		var err error
+		if clientID, err = url.QueryUnescape(clientID); err != nil {
+			return database.OauthClient{}, errInvalidClient
+		}
+		if secret, err = url.QueryUnescape(secret); err != nil {
+			return database.OauthClient{}, errInvalidClient
+		}
+	} else {
+		clientID = r.PostForm.Get("client_id")
+		secret = r.PostForm.Get("client_secret")
+	}
+
+	id, err := uuid.Parse(clientID)
+	if err != nil {
+		return database.OauthClient{}, errInvalidClient
+	}
+	client, err := cfg.db.GetOAuthClient(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return database.OauthClient{}, errInvalidClient
+		}
+		return database.OauthClient{}, err
+	}
+
+	if !client.SecretHash.Valid {
+		if secret != "" {
+			return database.OauthClient{}, errInvalidClient
+		}
+		return client, nil
+	}
+	if subtle.ConstantTimeCompare([]byte(auth.HashToken(secret)), []byte(client.SecretHash.String)) != 1 {
+		return database.OauthClient{}, errInvalidClient
+	}
+	return client, nil
+}
+
+// handlerOAuthToken exchanges an authorization code for an access token
+// and, for the openid scope, an ID token. Codes are single use and bound to
+// the client, the redirect URI and the PKCE code challenge.
+func (cfg *apiConfig) handlerOAuthToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		respondWithOAuthError(w, http.StatusBadRequest, "invalid_request", "Couldn't parse the request body", err)
+		return
+	}
+	if grantType := r.PostForm.Get("grant_type"); grantType != "authorization_code" {
+		respondWithOAuthError(w, http.StatusBadRequest, "unsupported_grant_type", "Only authorization_code is supported", nil)
+		return
+	}
+
+	client, err := cfg.authenticateOAuthClient(r)
+	if err != nil {
+		if errors.Is(err, errInvalidClient) {
+			respondWithOAuthError(w, http.StatusUnauthorized, "invalid_client", "Client authentication failed", nil)
+			return
+		}
+		respondWithOAuthError(w, http.StatusInternalServerError, "server_error", "", err)
+		return
+	}
+
+	code, err := cfg.db.ConsumeOAuthAuthorizationCode(r.Context(), auth.HashToken(r.PostForm.Get("code")))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithOAuthError(w, http.StatusBadRequest, "invalid_grant", "Invalid or expired code", err)
+			return
+		}
+		respondWithOAuthError(w, http.StatusInternalServerError, "server_error", "", err)
+		return
+	}
+	if code.ClientID != client.ID {
+		logSecurityEvent("oauth_code_misuse", code.UserID, "code for client %s presented by client %s", code.ClientID, client.ID)
+		respondWithOAuthError(w, http.StatusBadRequest, "invalid_grant", "Invalid or expired code", nil)
+		return
+	}
+	if r.PostForm.Get("redirect_uri") != code.RedirectURI {
+		respondWithOAuthError(w, http.StatusBadRequest, "invalid_grant", "redirect_uri does not match the authorization request", nil)
+		return
+	}
+	if !auth.VerifyPKCE(r.PostForm.Get("code_verifier"), code.CodeChallenge) {
+		respondWithOAuthError(w, http.StatusBadRequest, "invalid_grant", "Invalid code_verifier", nil)
+		return
+	}
+
+	// The user may have withdrawn consent since the code was issued.
+	consented, err := cfg.hasOAuthConsent(r, code.UserID, authorization{Client: client, Scopes: code.Scopes})
+	if err != nil {
+		respondWithOAuthError(w, http.StatusInternalServerError, "server_error", "", err)
+		return
+	}
+	if !consented {
+		respondWithOAuthError(w, http.StatusBadRequest, "invalid_grant", "Consent has been withdrawn", nil)
+		return
+	}
+
+	user, err := cfg.db.GetUserByID(r.Context(), code.UserID)
+	if err != nil {
+		respondWithOAuthError(w, http.StatusBadRequest, "invalid_grant", "Invalid or expired code", err)
+		return
+	}
+
+	ttl := cfg.tokenLifetimesFor(user).AccessTTL
+	accessToken, err := auth.MakeJWT(auth.Claims{
+		UserID: user.ID,
+		Scopes: code.Scopes,
+	}, cfg.jwtKeys, ttl)
+	if err != nil {
+		respondWithOAuthError(w, http.StatusInternalServerError, "server_error", "", err)
+		return
+	}
+
+	type response struct {
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type"`
+		ExpiresIn   int    `json:"expires_in"`
+		Scope       string `json:"scope"`
+		IDToken     string `json:"id_token,omitempty"`
+	}
+	res := response{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(ttl.Seconds()),
+		Scope:       strings.Join(code.Scopes, " "),
+	}
+
+	if slices.Contains(code.Scopes, auth.ScopeOpenID) {
+		res.IDToken, err = auth.MakeIDToken(userInfoFor(user, code.Scopes), client.ID.String(), code.Nonce, cfg.jwtKeys, ttl)
+		if err != nil {
+			respondWithOAuthError(w, http.StatusInternalServerError, "server_error", "", err)
+			return
+		}
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	respondWithJSON(w, http.StatusOK, res)
+}
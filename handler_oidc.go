@@ -0,0 +1,103 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/Skorgum/Chirpy/internal/auth"
+	"github.com/Skorgum/Chirpy/internal/database"
+)
+
+// oidcEnabled reports whether Chirpy can act as an OpenID Connect provider.
+// Clients verify ID tokens through the JWKS, so the signing key must be
+// asymmetric, and the issuer must be the server's public URL because
+// discovery is looked up relative to it.
+func (cfg *apiConfig) oidcEnabled() bool {
+	return cfg.jwtKeys.CanSignPublicly() &&
+		(strings.HasPrefix(cfg.jwtKeys.Issuer, "https://") || strings.HasPrefix(cfg.jwtKeys.Issuer, "http://"))
+}
+
+// userInfoFor returns the claims about user that scopes allow a client to
+// see.
+func userInfoFor(user database.User, scopes []string) auth.UserInfo {
+	info := auth.UserInfo{Subject: user.ID.String()}
+	if slices.Contains(scopes, auth.ScopeEmail) {
+		verified := user.EmailVerifiedAt.Valid
+		info.Email = user.Email
+		info.EmailVerified = &verified
+	}
+	if slices.Contains(scopes, auth.ScopeProfile) {
+		info.Name = user.DisplayName
+		info.PreferredUsername = user.Username.String
+		info.Picture = user.AvatarURL
+	}
+	return info
+}
+
+func (cfg *apiConfig) handlerOAuthUserInfo(w http.ResponseWriter, r *http.Request) {
+	claims, err := cfg.authenticate(r, auth.ScopeOpenID)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	user, err := cfg.db.GetUserByID(r.Context(), claims.UserID)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find user", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, userInfoFor(user, claims.Scopes))
+}
+
+// handlerOIDCDiscovery serves the OpenID Provider metadata. Chirpy has no
+// login pages of its own, so authorization_endpoint is the front end's
+// consent page (OAUTH_AUTHORIZE_URL), which calls /api/oauth/authorize.
+func (cfg *apiConfig) handlerOIDCDiscovery(w http.ResponseWriter, r *http.Request) {
+	if !cfg.oidcEnabled() {
+		respondWithError(w, http.StatusNotFound, "OpenID Connect is not enabled", nil)
+		return
+	}
+
+	type response struct {
+		Issuer                            string   `json:"issuer"`
+		AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+		TokenEndpoint                     string   `json:"token_endpoint"`
+		UserInfoEndpoint                  string   `json:"userinfo_endpoint"`
+		JWKSURI                           string   `json:"jwks_uri"`
+		ScopesSupported                   []string `json:"scopes_supported"`
+		ResponseTypesSupported            []string `json:"response_types_supported"`
+		GrantTypesSupported               []string `json:"grant_types_supported"`
+		SubjectTypesSupported             []string `json:"subject_types_supported"`
+		IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+		TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+		CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+		ClaimsSupported                   []string `json:"claims_supported"`
+	}
+
+	base := strings.TrimSuffix(cfg.jwtKeys.Issuer, "/")
+	authorizeURL := cfg.oauthAuthorizeURL
+	if authorizeURL == "" {
+		authorizeURL = base + "/app/oauth/authorize"
+	}
+
+	respondWithJSON(w, http.StatusOK, response{
+		Issuer:                            cfg.jwtKeys.Issuer,
+		AuthorizationEndpoint:             authorizeURL,
+		TokenEndpoint:                     base + "/api/oauth/token",
+		UserInfoEndpoint:                  base + "/api/oauth/userinfo",
+		JWKSURI:                           base + "/.well-known/jwks.json",
+		ScopesSupported:                   auth.OAuthScopes,
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               []string{"authorization_code"},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{cfg.jwtKeys.SigningAlgorithm()},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{auth.PKCEMethodS256},
+		ClaimsSupported: []string{
+			"sub", "iss", "aud", "exp", "iat", "nonce",
+			"email", "email_verified", "name", "preferred_username", "picture",
+		},
+	})
+}
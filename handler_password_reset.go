@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Skorgum/Chirpy/internal/auth"
+	"github.com/Skorgum/Chirpy/internal/database"
+	"github.com/Skorgum/Chirpy/internal/mail"
+	"github.com/google/uuid"
+)
+
+const (
+	passwordResetTokenTTL = time.Hour
+	// passwordResetTimeout bounds the work done for a reset request after
+	// the response has been sent.
+	passwordResetTimeout = time.Minute
+)
+
+// handlerPasswordForgot mails a reset token to the address if it belongs to
+// an account. The lookup and the mail happen after the response is sent, so
+// neither the response nor its timing shows which addresses are
+// registered. Requests are throttled per client IP. The mails sent to one
+// address are capped too, but going over the cap only holds the mail back:
+// the request still succeeds, so nobody can lock someone else out of
+// resetting their password.
+func (cfg *apiConfig) handlerPasswordForgot(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Email string `json:"email"`
+	}
+
+	var params parameters
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+
+	keys := []loginThrottleKey{passwordResetThrottleKey(r)}
+	_, wait, err := cfg.beginLoginAttempt(r.Context(), keys, uuid.Nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't start password reset", err)
+		return
+	}
+	if wait > 0 {
+		respondWithTooManyAttempts(w, wait, "Too many password reset requests, try again later")
+		return
+	}
+
+	ctx := context.WithoutCancel(r.Context())
+	cfg.runInBackground(func() { cfg.startPasswordReset(ctx, params.Email) })
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// startPasswordReset creates a reset token for the account with email, if
+// there is one, and mails it. If the address has already been sent as many
+// reset mails as it may be, nothing is done, which also leaves the token in
+// the last mail valid. It runs after handlerPasswordForgot has responded, so
+// errors are only logged.
+func (cfg *apiConfig) startPasswordReset(ctx context.Context, email string) {
+	ctx, cancel := context.WithTimeout(ctx, passwordResetTimeout)
+	defer cancel()
+
+	user, err := cfg.db.GetUserByEmail(ctx, email)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Couldn't look up user for password reset: %v", err)
+		}
+		return
+	}
+
+	keys := []loginThrottleKey{passwordResetMailThrottleKey(user.Email)}
+	_, wait, err := cfg.beginLoginAttempt(ctx, keys, user.ID)
+	if err != nil {
+		log.Printf("Couldn't check password reset mails sent to user %s: %v", user.ID, err)
+		return
+	}
+	if wait > 0 {
+		log.Printf("Not sending password reset email to user %s: too many sent in the last %s", user.ID, auth.DefaultResetEmailPolicy.Window)
+		return
+	}
+
+	token, err := auth.MakeToken()
+	if err != nil {
+		log.Printf("Couldn't create password reset token for user %s: %v", user.ID, err)
+		return
+	}
+
+	tx, err := cfg.dbConn.BeginTx(ctx, nil)
+	if err != nil {
+		log.Printf("Couldn't create password reset token for user %s: %v", user.ID, err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	if err := qtx.DeletePendingPasswordResetTokens(ctx, user.ID); err != nil {
+		log.Printf("Couldn't create password reset token for user %s: %v", user.ID, err)
+		return
+	}
+
+	err = qtx.CreatePasswordResetToken(ctx, database.CreatePasswordResetTokenParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    user.ID,
+		ExpiresAt: time.Now().UTC().Add(passwordResetTokenTTL),
+	})
+	if err != nil {
+		log.Printf("Couldn't create password reset token for user %s: %v", user.ID, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Couldn't create password reset token for user %s: %v", user.ID, err)
+		return
+	}
+
+	if err := cfg.sendPasswordResetEmail(ctx, user.Email, token); err != nil {
+		log.Printf("Failed to send password reset email to user %s: %v", user.ID, err)
+	}
+}
+
+func (cfg *apiConfig) sendPasswordResetEmail(ctx context.Context, to, token string) error {
+	return cfg.mailer.Send(ctx, mail.Message{
+		To:      to,
+		Subject: "Reset your Chirpy password",
+		Body: fmt.Sprintf("Someone asked to reset the password for your Chirpy account.\n\n"+
+			"To choose a new password, send this token to POST /api/password/reset:\n\n%s\n\n"+
+			"The token expires in %s. If this wasn't you, you can ignore this message.\n", token, passwordResetTokenTTL),
+	})
+}
+
+// handlerPasswordReset sets a new password and signs the user out everywhere
+// by revoking all of their refresh tokens.
+func (cfg *apiConfig) handlerPasswordReset(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+
+	var params parameters
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+	if params.Password == "" {
+		respondWithError(w, http.StatusBadRequest, "Password is required", nil)
+		return
+	}
+
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't reset password", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	reset, err := qtx.ConsumePasswordResetToken(r.Context(), auth.HashToken(params.Token))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusBadRequest, "Invalid or expired token", err)
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Couldn't reset password", err)
+		return
+	}
+
+	// A refused password rolls back the transaction, leaving the token
+	// usable for another try.
+	user, err := qtx.GetUserByID(r.Context(), reset.UserID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't reset password", err)
+		return
+	}
+	if !cfg.checkPassword(w, params.Password, user.Email) {
+		return
+	}
+	hashedPassword, err := auth.HashPassword(params.Password, cfg.passwordParams)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to hash password", err)
+		return
+	}
+
+	_, err = qtx.UpdateUserPassword(r.Context(), database.UpdateUserPasswordParams{
+		ID:             reset.UserID,
+		HashedPassword: hashedPassword,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't reset password", err)
+		return
+	}
+
+	if err := qtx.RevokeUserRefreshTokens(r.Context(), reset.UserID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't reset password", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't reset password", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
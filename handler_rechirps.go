@@ -0,0 +1,96 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/Skorgum/Chirpy/internal/auth"
+	"github.com/Skorgum/Chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+func (cfg *apiConfig) handlerRechirpCreate(w http.ResponseWriter, r *http.Request) {
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid chirp ID", err)
+		return
+	}
+
+	claims, err := cfg.authenticate(r, auth.ScopeChirpsWrite)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+	userID := claims.UserID
+
+	if err := cfg.ensureEmailVerified(r.Context(), userID); err != nil {
+		if errors.Is(err, errEmailNotVerified) {
+			respondWithError(w, http.StatusForbidden, "Verify your email address before chirping", err)
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Couldn't load user", err)
+		return
+	}
+
+	original, err := cfg.getOriginalChirp(r.Context(), chirpID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Chirp not found", err)
+		return
+	}
+
+	rechirp, err := cfg.db.CreateRechirp(r.Context(), database.CreateRechirpParams{
+		UserID:    userID,
+		RechirpOf: original.ID,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusConflict, "Chirp already rechirped", err)
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Failed to rechirp", err)
+		return
+	}
+
+	cfg.respondWithChirp(w, r, http.StatusCreated, rechirp)
+}
+
+func (cfg *apiConfig) handlerRechirpDelete(w http.ResponseWriter, r *http.Request) {
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid chirp ID", err)
+		return
+	}
+
+	claims, err := cfg.authenticate(r, auth.ScopeChirpsWrite)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+	userID := claims.UserID
+
+	dbChirp, err := cfg.db.GetChirp(r.Context(), chirpID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Chirp not found", err)
+		return
+	}
+	originalID := dbChirp.ID
+	if dbChirp.RechirpOf.Valid {
+		originalID = dbChirp.RechirpOf.UUID
+	}
+
+	deleted, err := cfg.db.DeleteRechirp(r.Context(), database.DeleteRechirpParams{
+		UserID:    userID,
+		RechirpOf: uuid.NullUUID{UUID: originalID, Valid: true},
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to undo rechirp", err)
+		return
+	}
+	if deleted == 0 {
+		respondWithError(w, http.StatusNotFound, "Rechirp not found", nil)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
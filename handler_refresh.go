@@ -1,15 +1,74 @@
 package main
 
 import (
+	"context"
+	"database/sql"
+	"errors"
 	"net/http"
 	"time"
 
 	"github.com/Skorgum/Chirpy/internal/auth"
+	"github.com/Skorgum/Chirpy/internal/database"
+	"github.com/google/uuid"
 )
 
+// createRefreshToken issues a refresh token for the given session, recording
+// the client that asked for it. A new login starts a session; every rotation
+// adds the next token to it.
+func (cfg *apiConfig) createRefreshToken(r *http.Request, q *database.Queries, userID, sessionID uuid.UUID, ttl time.Duration) (string, error) {
+	refreshToken, err := auth.MakeRefreshToken()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now().UTC()
+	_, err = q.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
+		TokenHash: cfg.hashRefreshToken(refreshToken),
+		UserID:    userID,
+		CreatedAt: now,
+		UpdatedAt: now,
+		ExpiresAt: now.Add(ttl),
+		SessionID: sessionID,
+		UserAgent: r.UserAgent(),
+		IP:        clientIP(r),
+	})
+	if err != nil {
+		return "", err
+	}
+	return refreshToken, nil
+}
+
+func (cfg *apiConfig) hashRefreshToken(token string) string {
+	return auth.HashRefreshToken(token, cfg.refreshTokenKey)
+}
+
+// hashLegacyRefreshTokens replaces refresh tokens stored in plain text before
+// hashing was introduced with their keyed hash, so existing sessions keep
+// working. It is a no-op once every row has been converted.
+func (cfg *apiConfig) hashLegacyRefreshTokens(ctx context.Context) (int, error) {
+	tokens, err := cfg.db.ListUnhashedRefreshTokens(ctx)
+	if err != nil {
+		return 0, err
+	}
+	for _, token := range tokens {
+		err := cfg.db.HashRefreshToken(ctx, database.HashRefreshTokenParams{
+			TokenHash: cfg.hashRefreshToken(token),
+			Token:     token,
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(tokens), nil
+}
+
+// handlerRefresh exchanges a refresh token for a new access token and a new
+// refresh token. The old refresh token stops working; presenting it again is
+// treated as theft and revokes the whole session.
 func (cfg *apiConfig) handlerRefresh(w http.ResponseWriter, r *http.Request) {
 	type response struct {
-		Token string `json:"token"`
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
 	}
 
 	refreshToken, err := auth.GetBearerToken(r.Header)
@@ -18,20 +77,85 @@ func (cfg *apiConfig) handlerRefresh(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := cfg.db.GetuserByRefreshToken(r.Context(), refreshToken)
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't get user for refresh token", err)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't refresh session", err)
 		return
 	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
 
-	accessToken, err := auth.MakeJWT(user.ID, cfg.jwtSecret, time.Hour)
+	stored, err := qtx.GetRefreshTokenForUpdate(r.Context(), cfg.hashRefreshToken(refreshToken))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusUnauthorized, "Couldn't get user for refresh token", err)
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Couldn't refresh session", err)
+		return
+	}
+
+	if stored.RotatedAt.Valid {
+		if _, err := qtx.RevokeSession(r.Context(), database.RevokeSessionParams{
+			SessionID: stored.SessionID,
+			UserID:    stored.UserID,
+		}); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't refresh session", err)
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't refresh session", err)
+			return
+		}
+		logSecurityEvent("refresh_token_reuse", stored.UserID,
+			"token rotated at %s was presented again; revoked session %s",
+			stored.RotatedAt.Time.Format(time.RFC3339), stored.SessionID)
+		respondWithError(w, http.StatusUnauthorized, "Refresh token has already been used", nil)
+		return
+	}
+
+	if stored.RevokedAt.Valid || !stored.ExpiresAt.After(time.Now().UTC()) {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't get user for refresh token", nil)
+		return
+	}
+
+	rotated, err := qtx.RotateRefreshToken(r.Context(), stored.TokenHash)
+	if err != nil || rotated != 1 {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't refresh session", err)
+		return
+	}
+
+	user, err := qtx.GetUserByID(r.Context(), stored.UserID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't refresh session", err)
+		return
+	}
+	lifetimes := cfg.tokenLifetimesFor(user)
+
+	newRefreshToken, err := cfg.createRefreshToken(r, qtx, user.ID, stored.SessionID, lifetimes.RefreshTTL)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't refresh session", err)
+		return
+	}
+
+	accessToken, err := auth.MakeJWT(auth.Claims{
+		UserID:    user.ID,
+		SessionID: stored.SessionID,
+		Scopes:    auth.AllScopes,
+	}, cfg.jwtKeys, lifetimes.AccessTTL)
 	if err != nil {
 		respondWithError(w, http.StatusUnauthorized, "Couldn't validate token", err)
 		return
 	}
 
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't refresh session", err)
+		return
+	}
+
 	respondWithJSON(w, http.StatusOK, response{
-		Token: accessToken,
+		Token:        accessToken,
+		RefreshToken: newRefreshToken,
 	})
 }
 
@@ -42,7 +166,7 @@ func (cfg *apiConfig) handlerRevoke(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err = cfg.db.RevokeRefreshToken(r.Context(), refreshToken)
+	_, err = cfg.db.RevokeRefreshToken(r.Context(), cfg.hashRefreshToken(refreshToken))
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke session", err)
 		return
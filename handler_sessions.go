@@ -0,0 +1,122 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/Skorgum/Chirpy/internal/auth"
+	"github.com/Skorgum/Chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// Session is one device a user is logged in on. LastUsedAt is the last
+// refresh or authenticated request, to within lastUsedInterval. Revoking
+// a session ends it at the next refresh. Only the access token making the request is revoked
+// immediately; others already issued for the session run out on their own.
+type Session struct {
+	ID         uuid.UUID `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	Current    bool      `json:"current"`
+}
+
+// clientIP returns the address of the peer that sent the request. Forwarding
+// headers are ignored since any client can set them.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func (cfg *apiConfig) handlerSessionsGet(w http.ResponseWriter, r *http.Request) {
+	claims, err := cfg.authenticate(r, auth.ScopeAccount)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	rows, err := cfg.db.ListActiveSessions(r.Context(), claims.UserID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve sessions", err)
+		return
+	}
+
+	sessions := make([]Session, 0, len(rows))
+	for _, row := range rows {
+		sessions = append(sessions, Session{
+			ID:         row.SessionID,
+			CreatedAt:  row.CreatedAt,
+			LastUsedAt: row.LastUsedAt,
+			ExpiresAt:  row.ExpiresAt,
+			UserAgent:  row.UserAgent,
+			IP:         row.IP,
+			Current:    row.SessionID == claims.SessionID,
+		})
+	}
+
+	respondWithJSON(w, http.StatusOK, sessions)
+}
+
+func (cfg *apiConfig) handlerSessionDelete(w http.ResponseWriter, r *http.Request) {
+	sessionID, err := uuid.Parse(r.PathValue("sessionID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid session ID", err)
+		return
+	}
+
+	claims, err := cfg.authenticate(r, auth.ScopeAccount)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	revoked, err := cfg.db.RevokeSession(r.Context(), database.RevokeSessionParams{
+		SessionID: sessionID,
+		UserID:    claims.UserID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke session", err)
+		return
+	}
+	if revoked == 0 {
+		respondWithError(w, http.StatusNotFound, "Session not found", nil)
+		return
+	}
+
+	if sessionID == claims.SessionID {
+		if err := cfg.revokeAccessToken(r.Context(), claims); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't revoke session", err)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerSessionsRevokeAll logs the user out everywhere, including the
+// session making the request, whose access token stops working at once.
+func (cfg *apiConfig) handlerSessionsRevokeAll(w http.ResponseWriter, r *http.Request) {
+	claims, err := cfg.authenticate(r, auth.ScopeAccount)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	if err := cfg.db.RevokeUserRefreshTokens(r.Context(), claims.UserID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke sessions", err)
+		return
+	}
+
+	if err := cfg.revokeAccessToken(r.Context(), claims); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke sessions", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/Skorgum/Chirpy/internal/auth"
+	"github.com/Skorgum/Chirpy/internal/database"
+)
+
+func (cfg *apiConfig) handlerTimeline(w http.ResponseWriter, r *http.Request) {
+	claims, err := cfg.authenticate(r, auth.ScopeChirpsRead)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+	userID := claims.UserID
+
+	page, err := parseNewestFirstPageParams(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	dbChirps, err := cfg.db.ListTimelineChirps(r.Context(), database.ListTimelineChirpsParams{
+		FollowerID:      userID,
+		CursorCreatedAt: page.Cursor.CreatedAt,
+		CursorID:        page.Cursor.ID,
+		Limit:           page.Limit + 1,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to get timeline", err)
+		return
+	}
+
+	cfg.respondWithChirpPage(w, r, page, dbChirps)
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Skorgum/Chirpy/internal/auth"
+	"github.com/Skorgum/Chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const maxPersonalAccessTokenNameLength = 100
+
+// PersonalAccessToken describes a token without revealing it; the token
+// itself is only returned once, when it is created.
+type PersonalAccessToken struct {
+	ID         uuid.UUID  `json:"id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	Token      string     `json:"token,omitempty"`
+}
+
+func personalAccessTokenFromDB(pat database.PersonalAccessToken) PersonalAccessToken {
+	return PersonalAccessToken{
+		ID:         pat.ID,
+		Name:       pat.Name,
+		Scopes:     pat.Scopes,
+		CreatedAt:  pat.CreatedAt,
+		LastUsedAt: nullTimePtr(pat.LastUsedAt),
+		ExpiresAt:  nullTimePtr(pat.ExpiresAt),
+	}
+}
+
+func nullTimePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+func (cfg *apiConfig) handlerTokensCreate(w http.ResponseWriter, r *http.Request) {
+	claims, err := cfg.authenticate(r, auth.ScopeAccount)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	type parameters struct {
+		Name          string   `json:"name"`
+		Scopes        []string `json:"scopes"`
+		ExpiresInDays int      `json:"expires_in_days"`
+	}
+
+	var params parameters
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+
+	name := strings.TrimSpace(params.Name)
+	if name == "" || len(name) > maxPersonalAccessTokenNameLength {
+		respondWithError(w, http.StatusBadRequest, "Name must be 1-100 characters", nil)
+		return
+	}
+
+	scopes, err := auth.ValidatePersonalAccessTokenScopes(params.Scopes)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	if params.ExpiresInDays < 0 {
+		respondWithError(w, http.StatusBadRequest, "expires_in_days must not be negative", nil)
+		return
+	}
+	var expiresAt sql.NullTime
+	if params.ExpiresInDays > 0 {
+		expiresAt = sql.NullTime{
+			Time:  time.Now().UTC().AddDate(0, 0, params.ExpiresInDays),
+			Valid: true,
+		}
+	}
+
+	token, err := auth.MakePersonalAccessToken()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create token", err)
+		return
+	}
+
+	pat, err := cfg.db.CreatePersonalAccessToken(r.Context(), database.CreatePersonalAccessTokenParams{
+		UserID:    claims.UserID,
+		Name:      name,
+		TokenHash: auth.HashToken(token),
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create token", err)
+		return
+	}
+
+	resp := personalAccessTokenFromDB(pat)
+	resp.Token = token
+	respondWithJSON(w, http.StatusCreated, resp)
+}
+
+func (cfg *apiConfig) handlerTokensGet(w http.ResponseWriter, r *http.Request) {
+	claims, err := cfg.authenticate(r, auth.ScopeAccount)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	pats, err := cfg.db.ListPersonalAccessTokens(r.Context(), claims.UserID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve tokens", err)
+		return
+	}
+
+	tokens := make([]PersonalAccessToken, 0, len(pats))
+	for _, pat := range pats {
+		tokens = append(tokens, personalAccessTokenFromDB(pat))
+	}
+
+	respondWithJSON(w, http.StatusOK, tokens)
+}
+
+func (cfg *apiConfig) handlerTokenDelete(w http.ResponseWriter, r *http.Request) {
+	tokenID, err := uuid.Parse(r.PathValue("tokenID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid token ID", err)
+		return
+	}
+
+	claims, err := cfg.authenticate(r, auth.ScopeAccount)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	revoked, err := cfg.db.RevokePersonalAccessToken(r.Context(), database.RevokePersonalAccessTokenParams{
+		ID:     tokenID,
+		UserID: claims.UserID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke token", err)
+		return
+	}
+	if revoked == 0 {
+		respondWithError(w, http.StatusNotFound, "Token not found", nil)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
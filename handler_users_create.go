@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/json"
+	"log"
 	"net/http"
 	"time"
 
@@ -11,11 +12,12 @@ import (
 )
 
 type response struct {
-	ID          uuid.UUID `json:"id"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
-	Email       string    `json:"email"`
-	IsChirpyRed bool      `json:"is_chirpy_red"`
+	ID            uuid.UUID `json:"id"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	Email         string    `json:"email"`
+	IsChirpyRed   bool      `json:"is_chirpy_red"`
+	EmailVerified bool      `json:"email_verified"`
 }
 
 func (apiCfg *apiConfig) handlerUsersCreate(w http.ResponseWriter, r *http.Request) {
@@ -32,26 +34,65 @@ func (apiCfg *apiConfig) handlerUsersCreate(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	hashedPassword, err := auth.HashPassword(params.Password)
+	if err := validateEmail(params.Email); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	if !apiCfg.checkPassword(w, params.Password, params.Email) {
+		return
+	}
+
+	hashedPassword, err := auth.HashPassword(params.Password, apiCfg.passwordParams)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Failed to hash password", err)
 		return
 	}
 
-	user, err := apiCfg.db.CreateUser(r.Context(), database.CreateUserParams{
+	tx, err := apiCfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to create user", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := apiCfg.db.WithTx(tx)
+
+	user, err := qtx.CreateUser(r.Context(), database.CreateUserParams{
 		Email:          params.Email,
 		HashedPassword: hashedPassword,
 	})
 	if err != nil {
+		if isUniqueViolation(err) {
+			respondWithError(w, http.StatusConflict, "Email is already in use", err)
+			return
+		}
 		respondWithError(w, http.StatusInternalServerError, "Failed to create user", err)
 		return
 	}
 
+	verificationToken, err := apiCfg.createEmailVerificationToken(r.Context(), qtx, user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to create user", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to create user", err)
+		return
+	}
+
+	// The account exists either way; a failed send can be retried through
+	// POST /api/users/verify/resend.
+	if err := apiCfg.sendVerificationEmail(r.Context(), user.Email, verificationToken); err != nil {
+		log.Printf("Failed to send verification email to user %s: %v", user.ID, err)
+	}
+
 	respondWithJSON(w, http.StatusCreated, response{
-		ID:          user.ID,
-		CreatedAt:   user.CreatedAt,
-		UpdatedAt:   user.UpdatedAt,
-		Email:       user.Email,
-		IsChirpyRed: user.IsChirpyRed,
+		ID:            user.ID,
+		CreatedAt:     user.CreatedAt,
+		UpdatedAt:     user.UpdatedAt,
+		Email:         user.Email,
+		IsChirpyRed:   user.IsChirpyRed,
+		EmailVerified: user.EmailVerifiedAt.Valid,
 	})
 }
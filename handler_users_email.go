@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Skorgum/Chirpy/internal/auth"
+	"github.com/Skorgum/Chirpy/internal/database"
+	"github.com/Skorgum/Chirpy/internal/mail"
+	"github.com/google/uuid"
+)
+
+const emailChangeTokenTTL = 24 * time.Hour
+
+// createEmailChangeToken stores a confirmation token for newEmail, replacing
+// any change the user still had pending. Only the token's hash is stored.
+func (cfg *apiConfig) createEmailChangeToken(ctx context.Context, q *database.Queries, userID uuid.UUID, newEmail string) (string, error) {
+	token, err := auth.MakeToken()
+	if err != nil {
+		return "", err
+	}
+
+	if err := q.DeletePendingEmailChangeTokens(ctx, userID); err != nil {
+		return "", err
+	}
+
+	err = q.CreateEmailChangeToken(ctx, database.CreateEmailChangeTokenParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    userID,
+		NewEmail:  newEmail,
+		ExpiresAt: time.Now().UTC().Add(emailChangeTokenTTL),
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+func (cfg *apiConfig) sendEmailChangeConfirmation(ctx context.Context, to, token string) error {
+	return cfg.mailer.Send(ctx, mail.Message{
+		To:      to,
+		Subject: "Confirm your new Chirpy email address",
+		Body: fmt.Sprintf("Someone asked to change the email address on a Chirpy account to this one.\n\n"+
+			"To confirm, send this token to POST /api/users/email/confirm:\n\n%s\n\n"+
+			"The token expires in %s. If this wasn't you, you can ignore this message.\n", token, emailChangeTokenTTL),
+	})
+}
+
+func (cfg *apiConfig) handlerUsersEmailConfirm(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Token string `json:"token"`
+	}
+
+	var params parameters
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to confirm email", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	emailChange, err := qtx.ConsumeEmailChangeToken(r.Context(), auth.HashToken(params.Token))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusBadRequest, "Invalid or expired token", err)
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Failed to confirm email", err)
+		return
+	}
+
+	user, err := qtx.UpdateUserEmail(r.Context(), database.UpdateUserEmailParams{
+		ID:    emailChange.UserID,
+		Email: emailChange.NewEmail,
+	})
+	if err != nil {
+		if isUniqueViolation(err) {
+			respondWithError(w, http.StatusConflict, "Email is already in use", err)
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Failed to confirm email", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to confirm email", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, userResponseFromDB(user))
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Skorgum/Chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// UserProfile is the public view of a user. It must never carry the email
+// address or password hash.
+type UserProfile struct {
+	ID          uuid.UUID `json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	Username    string    `json:"username,omitempty"`
+	DisplayName string    `json:"display_name"`
+	Bio         string    `json:"bio"`
+	AvatarURL   string    `json:"avatar_url"`
+	IsChirpyRed bool      `json:"is_chirpy_red"`
+}
+
+func profileFromDB(user database.User) UserProfile {
+	return UserProfile{
+		ID:          user.ID,
+		CreatedAt:   user.CreatedAt,
+		Username:    user.Username.String,
+		DisplayName: user.DisplayName,
+		Bio:         user.Bio,
+		AvatarURL:   user.AvatarURL,
+		IsChirpyRed: user.IsChirpyRed,
+	}
+}
+
+func (cfg *apiConfig) handlerUsersGet(w http.ResponseWriter, r *http.Request) {
+	idOrHandle := r.PathValue("idOrHandle")
+
+	var user database.User
+	var err error
+	if userID, parseErr := uuid.Parse(idOrHandle); parseErr == nil {
+		user, err = cfg.db.GetUserByID(r.Context(), userID)
+	} else {
+		user, err = cfg.db.GetUserByUsername(r.Context(), strings.TrimPrefix(idOrHandle, "@"))
+	}
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusNotFound, "User not found", err)
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Failed to get user", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, profileFromDB(user))
+}
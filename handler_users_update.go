@@ -1,38 +1,82 @@
 package main
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/Skorgum/Chirpy/internal/auth"
 	"github.com/Skorgum/Chirpy/internal/database"
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
+const (
+	maxDisplayNameLength = 50
+	maxBioLength         = 160
+	maxAvatarURLLength   = 2048
+)
+
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9_]{3,30}$`)
+
+// reservedUsernames can't be claimed because they would be confusing in
+// mentions or collide with names the service uses itself.
+var reservedUsernames = map[string]struct{}{
+	"about":     {},
+	"admin":     {},
+	"api":       {},
+	"chirpy":    {},
+	"help":      {},
+	"me":        {},
+	"moderator": {},
+	"null":      {},
+	"root":      {},
+	"security":  {},
+	"settings":  {},
+	"staff":     {},
+	"support":   {},
+	"system":    {},
+}
+
 type userResponse struct {
-	ID        uuid.UUID `json:"id"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	Email     string    `json:"email"`
+	ID            uuid.UUID `json:"id"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	Email         string    `json:"email"`
+	EmailVerified bool      `json:"email_verified"`
+	Username      string    `json:"username,omitempty"`
+	DisplayName   string    `json:"display_name"`
+	Bio           string    `json:"bio"`
+	AvatarURL     string    `json:"avatar_url"`
 }
 
+// handlerUsersUpdate applies a partial update: fields missing from the body
+// are left as they are. Changing the password requires the current one, and
+// a new email only takes effect once the address has been confirmed.
 func (cfg *apiConfig) handlerUsersUpdate(w http.ResponseWriter, r *http.Request) {
-	token, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't find token", err)
-		return
-	}
-
-	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	claims, err := cfg.authenticate(r, auth.ScopeProfileWrite)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't validate token", err)
+		respondWithAuthError(w, err)
 		return
 	}
+	userID := claims.UserID
 
 	type parameters struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
+		Email           *string `json:"email"`
+		Password        *string `json:"password"`
+		CurrentPassword string  `json:"current_password"`
+		Username        *string `json:"username"`
+		DisplayName     *string `json:"display_name"`
+		Bio             *string `json:"bio"`
+		AvatarURL       *string `json:"avatar_url"`
 	}
 
 	decoder := json.NewDecoder(r.Body)
@@ -43,26 +87,195 @@ func (cfg *apiConfig) handlerUsersUpdate(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	hashedPassword, err := auth.HashPassword(params.Password)
+	if (params.Email != nil || params.Password != nil) && !claims.HasScope(auth.ScopeAccount) {
+		respondWithError(w, http.StatusForbidden, "Changing email or password requires the account scope", nil)
+		return
+	}
+	if params.Email != nil {
+		if err := validateEmail(*params.Email); err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error(), err)
+			return
+		}
+	}
+	if params.Username != nil {
+		if err := validateUsername(*params.Username); err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error(), err)
+			return
+		}
+	}
+	if err := validateProfile(params.DisplayName, params.Bio, params.AvatarURL); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	user, err := cfg.db.GetUserByID(r.Context(), userID)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Failed to hash password", err)
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate token", err)
 		return
 	}
 
-	user, err := cfg.db.UpdateUser(r.Context(), database.UpdateUserParams{
-		ID:             userID,
-		Email:          params.Email,
-		HashedPassword: hashedPassword,
-	})
+	if params.Email != nil && *params.Email != user.Email {
+		_, err := cfg.db.GetUserByEmail(r.Context(), *params.Email)
+		if err == nil {
+			respondWithError(w, http.StatusConflict, "Email is already in use", nil)
+			return
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusInternalServerError, "Failed to update user", err)
+			return
+		}
+	}
+
+	var hashedPassword string
+	if params.Password != nil {
+		ok, err := auth.CheckPasswordHash(params.CurrentPassword, user.HashedPassword)
+		if err != nil || !ok {
+			respondWithError(w, http.StatusForbidden, "Current password is incorrect", err)
+			return
+		}
+		email := user.Email
+		if params.Email != nil {
+			email = *params.Email
+		}
+		if !cfg.checkPassword(w, *params.Password, email) {
+			return
+		}
+		hashedPassword, err = auth.HashPassword(*params.Password, cfg.passwordParams)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Failed to hash password", err)
+			return
+		}
+	}
+
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Failed to update user", err)
 		return
 	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	if params.Password != nil {
+		user, err = qtx.UpdateUserPassword(r.Context(), database.UpdateUserPasswordParams{
+			ID:             userID,
+			HashedPassword: hashedPassword,
+		})
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Failed to update user", err)
+			return
+		}
+	}
+
+	if params.Username != nil || params.DisplayName != nil || params.Bio != nil || params.AvatarURL != nil {
+		user, err = qtx.UpdateUserProfile(r.Context(), database.UpdateUserProfileParams{
+			ID:          userID,
+			Username:    nullString(params.Username),
+			DisplayName: nullString(params.DisplayName),
+			Bio:         nullString(params.Bio),
+			AvatarURL:   nullString(params.AvatarURL),
+		})
+		if err != nil {
+			if isUniqueViolation(err) {
+				respondWithError(w, http.StatusConflict, "Username is already taken", err)
+				return
+			}
+			respondWithError(w, http.StatusInternalServerError, "Failed to update user", err)
+			return
+		}
+	}
+
+	var emailToken string
+	if params.Email != nil && *params.Email != user.Email {
+		emailToken, err = cfg.createEmailChangeToken(r.Context(), qtx, userID, *params.Email)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Failed to update user", err)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to update user", err)
+		return
+	}
+
+	resp := struct {
+		userResponse
+		PendingEmail string `json:"pending_email,omitempty"`
+	}{
+		userResponse: userResponseFromDB(user),
+	}
+
+	// The rest of the update is already saved, so a failed send is only
+	// logged; the user can ask for the change again to get a new token.
+	if emailToken != "" {
+		if err := cfg.sendEmailChangeConfirmation(r.Context(), *params.Email, emailToken); err != nil {
+			log.Printf("Failed to send email change confirmation to user %s: %v", userID, err)
+		}
+		resp.PendingEmail = *params.Email
+	}
+
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+func userResponseFromDB(user database.User) userResponse {
+	return userResponse{
+		ID:            user.ID,
+		CreatedAt:     user.CreatedAt,
+		UpdatedAt:     user.UpdatedAt,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerifiedAt.Valid,
+		Username:      user.Username.String,
+		DisplayName:   user.DisplayName,
+		Bio:           user.Bio,
+		AvatarURL:     user.AvatarURL,
+	}
+}
+
+func validateEmail(email string) error {
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return errors.New("Invalid email address")
+	}
+	return nil
+}
+
+func validateUsername(username string) error {
+	if !usernamePattern.MatchString(username) {
+		return errors.New("Username must be 3-30 letters, digits or underscores")
+	}
+	if _, ok := reservedUsernames[strings.ToLower(username)]; ok {
+		return errors.New("Username is reserved")
+	}
+	return nil
+}
+
+func validateProfile(displayName, bio, avatarURL *string) error {
+	if displayName != nil && utf8.RuneCountInString(*displayName) > maxDisplayNameLength {
+		return errors.New("Display name is too long")
+	}
+	if bio != nil && utf8.RuneCountInString(*bio) > maxBioLength {
+		return errors.New("Bio is too long")
+	}
+	if avatarURL != nil && *avatarURL != "" {
+		if len(*avatarURL) > maxAvatarURLLength {
+			return errors.New("Avatar URL is too long")
+		}
+		u, err := url.Parse(*avatarURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.New("Avatar URL must be an http or https URL")
+		}
+	}
+	return nil
+}
+
+func nullString(s *string) sql.NullString {
+	if s == nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: *s, Valid: true}
+}
 
-	respondWithJSON(w, http.StatusOK, userResponse{
-		ID:        user.ID,
-		CreatedAt: user.CreatedAt,
-		UpdatedAt: user.UpdatedAt,
-		Email:     user.Email,
-	})
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
 }
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Skorgum/Chirpy/internal/auth"
+	"github.com/Skorgum/Chirpy/internal/database"
+	"github.com/Skorgum/Chirpy/internal/mail"
+	"github.com/google/uuid"
+)
+
+const emailVerificationTokenTTL = 48 * time.Hour
+
+var errEmailNotVerified = errors.New("email address is not verified")
+
+// createEmailVerificationToken issues a single-use verification token for the
+// user, invalidating any earlier one that hasn't been used yet.
+func (cfg *apiConfig) createEmailVerificationToken(ctx context.Context, q *database.Queries, userID uuid.UUID) (string, error) {
+	token, err := auth.MakeToken()
+	if err != nil {
+		return "", err
+	}
+
+	if err := q.DeletePendingEmailVerificationTokens(ctx, userID); err != nil {
+		return "", err
+	}
+
+	err = q.CreateEmailVerificationToken(ctx, database.CreateEmailVerificationTokenParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    userID,
+		ExpiresAt: time.Now().UTC().Add(emailVerificationTokenTTL),
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+func (cfg *apiConfig) sendVerificationEmail(ctx context.Context, to, token string) error {
+	return cfg.mailer.Send(ctx, mail.Message{
+		To:      to,
+		Subject: "Verify your Chirpy email address",
+		Body: fmt.Sprintf("Welcome to Chirpy!\n\n"+
+			"To verify your email address, send this token to POST /api/users/verify:\n\n%s\n\n"+
+			"The token expires in %s.\n", token, emailVerificationTokenTTL),
+	})
+}
+
+// ensureEmailVerified returns errEmailNotVerified when unverified accounts
+// are restricted and the user hasn't verified their address yet. Accounts
+// from before verification existed are let through here, and only here.
+func (cfg *apiConfig) ensureEmailVerified(ctx context.Context, userID uuid.UUID) error {
+	if !cfg.requireVerifiedEmail {
+		return nil
+	}
+	user, err := cfg.db.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !user.EmailVerifiedAt.Valid && !user.GrandfatheredUnverified {
+		return errEmailNotVerified
+	}
+	return nil
+}
+
+func (cfg *apiConfig) handlerUsersVerify(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Token string `json:"token"`
+	}
+
+	var params parameters
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to verify email", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	verification, err := qtx.ConsumeEmailVerificationToken(r.Context(), auth.HashToken(params.Token))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusBadRequest, "Invalid or expired token", err)
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Failed to verify email", err)
+		return
+	}
+
+	user, err := qtx.MarkUserEmailVerified(r.Context(), verification.UserID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to verify email", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to verify email", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, userResponseFromDB(user))
+}
+
+func (cfg *apiConfig) handlerUsersVerifyResend(w http.ResponseWriter, r *http.Request) {
+	claims, err := cfg.authenticate(r, auth.ScopeAccount)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+	userID := claims.UserID
+
+	user, err := cfg.db.GetUserByID(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate token", err)
+		return
+	}
+	if user.EmailVerifiedAt.Valid {
+		respondWithError(w, http.StatusConflict, "Email is already verified", nil)
+		return
+	}
+
+	verificationToken, err := cfg.createEmailVerificationToken(r.Context(), cfg.db, userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to create verification token", err)
+		return
+	}
+
+	if err := cfg.sendVerificationEmail(r.Context(), user.Email, verificationToken); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to send verification email", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -1,9 +1,12 @@
 package auth
 
 import (
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"errors"
+	"fmt"
 	"net/http"
 	"strings"
 	"time"
@@ -13,8 +16,15 @@ import (
 	"github.com/google/uuid"
 )
 
-func HashPassword(password string) (string, error) {
-	hash, err := argon2id.CreateHash(password, argon2id.DefaultParams)
+// ErrEmptyPassword is returned by HashPassword for an empty password.
+var ErrEmptyPassword = errors.New("password is empty")
+
+// HashPassword hashes password with argon2id using params.
+func HashPassword(password string, params PasswordParams) (string, error) {
+	if password == "" {
+		return "", ErrEmptyPassword
+	}
+	hash, err := argon2id.CreateHash(password, params.argon2id())
 	if err != nil {
 		return "", err
 	}
@@ -25,42 +35,53 @@ func CheckPasswordHash(password, hash string) (bool, error) {
 	return argon2id.ComparePasswordAndHash(password, hash)
 }
 
-func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
-	claims := jwt.RegisteredClaims{
-		Issuer:    "chirpy",
-		IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
-		ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(expiresIn)),
-		Subject:   userID.String(),
+// MakeJWT signs an access token for claims that expires after expiresIn. The
+// keyring's issuer and audience, a fresh jti and the issue and expiry times
+// are filled in; an empty Type means TokenTypeAccess.
+func MakeJWT(claims Claims, keys *Keyring, expiresIn time.Duration) (string, error) {
+	if claims.Type == "" {
+		claims.Type = TokenTypeAccess
 	}
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	signedToken, err := token.SignedString([]byte(tokenSecret))
-	if err != nil {
-		return "", err
-	}
-
-	return signedToken, nil
+	now := time.Now().UTC()
+	return keys.Sign(jwtClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    keys.Issuer,
+			Audience:  jwt.ClaimStrings{keys.Audience},
+			Subject:   claims.UserID.String(),
+			ID:        uuid.NewString(),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(expiresIn)),
+		},
+		SessionID: uuidClaim(claims.SessionID),
+		Type:      claims.Type,
+		Scope:     strings.Join(claims.Scopes, " "),
+	})
 }
 
-func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &jwt.RegisteredClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(tokenSecret), nil
-	})
+// ValidateJWT checks the signature, expiry, issuer and audience of a token
+// and that it is of tokenType, and returns its claims.
+func ValidateJWT(tokenString string, keys *Keyring, tokenType string) (Claims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &jwtClaims{}, keys.keyfunc,
+		jwt.WithIssuer(keys.Issuer),
+		jwt.WithAudience(keys.Audience),
+		jwt.WithExpirationRequired(),
+	)
 	if err != nil {
-		return uuid.Nil, err
+		return Claims{}, err
 	}
 
-	claims, ok := token.Claims.(*jwt.RegisteredClaims)
+	parsed, ok := token.Claims.(*jwtClaims)
 	if !ok || !token.Valid {
-		return uuid.Nil, jwt.ErrTokenInvalidClaims
+		return Claims{}, jwt.ErrTokenInvalidClaims
 	}
-
-	id, err := uuid.Parse(claims.Subject)
-	if err != nil {
-		return uuid.Nil, err
+	if parsed.Type != tokenType {
+		return Claims{}, fmt.Errorf("%w: token type is %q, want %q", jwt.ErrTokenInvalidClaims, parsed.Type, tokenType)
+	}
+	if parsed.ID == "" {
+		return Claims{}, fmt.Errorf("%w: token has no ID", jwt.ErrTokenInvalidClaims)
 	}
 
-	return id, nil
+	return parsed.claims()
 }
 
 func GetBearerToken(headers http.Header) (string, error) {
@@ -83,6 +104,11 @@ func GetBearerToken(headers http.Header) (string, error) {
 }
 
 func MakeRefreshToken() (string, error) {
+	return MakeToken()
+}
+
+// MakeToken returns a random 256-bit token, hex encoded.
+func MakeToken() (string, error) {
 	b := make([]byte, 32)
 	if _, err := rand.Read(b); err != nil {
 		return "", err
@@ -90,6 +116,22 @@ func MakeRefreshToken() (string, error) {
 	return hex.EncodeToString(b), nil
 }
 
+// HashToken returns the hex SHA-256 of a token so single-use tokens can be
+// stored without keeping the token itself.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// HashRefreshToken returns the hex HMAC-SHA256 of a refresh token under key.
+// Refresh tokens are long-lived, so unlike HashToken the digest is keyed: a
+// copy of the database alone isn't enough to check guesses against it.
+func HashRefreshToken(token string, key []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(token))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
 func GetAPIKey(headers http.Header) (string, error) {
 	apiKey := headers.Get("Authorization")
 	if apiKey == "" {
@@ -11,8 +11,8 @@ func TestCheckPasswordHash(t *testing.T) {
 	// First, we need to create some hashed passwords for testing
 	password1 := "correctPassword123!"
 	password2 := "anotherPassword456!"
-	hash1, _ := HashPassword(password1)
-	hash2, _ := HashPassword(password2)
+	hash1, _ := HashPassword(password1, DefaultPasswordParams())
+	hash2, _ := HashPassword(password2, DefaultPasswordParams())
 
 	tests := []struct {
 		name          string
@@ -71,44 +71,86 @@ func TestCheckPasswordHash(t *testing.T) {
 	}
 }
 
+func hmacKeyring(t *testing.T, secret string) *Keyring {
+	t.Helper()
+	keys, err := NewKeyring(LegacyKeyID, NewHMACKey(LegacyKeyID, []byte(secret)))
+	if err != nil {
+		t.Fatalf("Failed to create keyring: %v", err)
+	}
+	return keys
+}
+
 func TestValidateJWT(t *testing.T) {
 	userID := uuid.New()
+	keys := hmacKeyring(t, "secret")
 
-	validToken, err := MakeJWT(userID, "secret", time.Hour)
+	validToken, err := MakeJWT(Claims{UserID: userID}, keys, time.Hour)
 	if err != nil {
 		t.Fatalf("Failed to create valid JWT: %v", err)
 	}
 
-	expiredToken, err := MakeJWT(userID, "secret", -time.Hour)
+	expiredToken, err := MakeJWT(Claims{UserID: userID}, keys, -time.Hour)
 	if err != nil {
 		t.Fatalf("Failed to create expired JWT: %v", err)
 	}
 
+	otherTypeToken, err := MakeJWT(Claims{UserID: userID, Type: "other"}, keys, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create JWT: %v", err)
+	}
+
+	otherAudience := hmacKeyring(t, "secret")
+	otherAudience.Audience = "another-service"
+
+	otherIssuer := hmacKeyring(t, "secret")
+	otherIssuer.Issuer = "another-issuer"
+
 	tests := []struct {
 		name        string
 		tokenString string
-		tokenSecret string
+		keys        *Keyring
 		wantUserID  uuid.UUID
 		wantErr     bool
 	}{
 		{
 			name:        "Valid token",
 			tokenString: validToken,
-			tokenSecret: "secret",
+			keys:        keys,
 			wantUserID:  userID,
 			wantErr:     false,
 		},
 		{
 			name:        "Wrong secret",
 			tokenString: validToken,
-			tokenSecret: "wrong_secret",
+			keys:        hmacKeyring(t, "wrong_secret"),
 			wantUserID:  uuid.Nil,
 			wantErr:     true,
 		},
 		{
 			name:        "Expired token",
 			tokenString: expiredToken,
-			tokenSecret: "secret",
+			keys:        keys,
+			wantUserID:  uuid.Nil,
+			wantErr:     true,
+		},
+		{
+			name:        "Wrong token type",
+			tokenString: otherTypeToken,
+			keys:        keys,
+			wantUserID:  uuid.Nil,
+			wantErr:     true,
+		},
+		{
+			name:        "Wrong audience",
+			tokenString: validToken,
+			keys:        otherAudience,
+			wantUserID:  uuid.Nil,
+			wantErr:     true,
+		},
+		{
+			name:        "Wrong issuer",
+			tokenString: validToken,
+			keys:        otherIssuer,
 			wantUserID:  uuid.Nil,
 			wantErr:     true,
 		},
@@ -116,18 +158,61 @@ func TestValidateJWT(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			gotUserID, err := ValidateJWT(tt.tokenString, tt.tokenSecret)
+			got, err := ValidateJWT(tt.tokenString, tt.keys, TokenTypeAccess)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("ValidateJWT() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
-			if !tt.wantErr && gotUserID != tt.wantUserID {
-				t.Errorf("ValidateJWT() gotUserID = %v, want %v", gotUserID, tt.wantUserID)
+			if !tt.wantErr && got.UserID != tt.wantUserID {
+				t.Errorf("ValidateJWT() gotUserID = %v, want %v", got.UserID, tt.wantUserID)
 			}
 		})
 	}
 }
 
+func TestValidateJWTClaims(t *testing.T) {
+	keys := hmacKeyring(t, "secret")
+	want := Claims{
+		UserID:    uuid.New(),
+		SessionID: uuid.New(),
+		Scopes:    []string{ScopeChirpsRead, ScopeProfileWrite},
+	}
+
+	token, err := MakeJWT(want, keys, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create JWT: %v", err)
+	}
+	other, err := MakeJWT(want, keys, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create JWT: %v", err)
+	}
+
+	got, err := ValidateJWT(token, keys, TokenTypeAccess)
+	if err != nil {
+		t.Fatalf("ValidateJWT() error = %v", err)
+	}
+	gotOther, err := ValidateJWT(other, keys, TokenTypeAccess)
+	if err != nil {
+		t.Fatalf("ValidateJWT() error = %v", err)
+	}
+
+	if got.UserID != want.UserID || got.SessionID != want.SessionID {
+		t.Errorf("ValidateJWT() = %+v, want user %v and session %v", got, want.UserID, want.SessionID)
+	}
+	if got.Type != TokenTypeAccess {
+		t.Errorf("ValidateJWT() Type = %q, want %q", got.Type, TokenTypeAccess)
+	}
+	if !got.HasScope(ScopeChirpsRead) || !got.HasScope(ScopeProfileWrite) || got.HasScope(ScopeChirpsWrite) {
+		t.Errorf("ValidateJWT() Scopes = %v, want %v", got.Scopes, want.Scopes)
+	}
+	if got.ID == "" || got.ID == gotOther.ID {
+		t.Errorf("ValidateJWT() IDs = %q and %q, want unique non-empty IDs", got.ID, gotOther.ID)
+	}
+	if time.Until(got.ExpiresAt) <= 0 || time.Until(got.ExpiresAt) > time.Hour {
+		t.Errorf("ValidateJWT() ExpiresAt = %v, want within the next hour", got.ExpiresAt)
+	}
+}
+
 func TestGetBearerToken(t *testing.T) {
 	tests := []struct {
 		name      string
@@ -192,3 +277,68 @@ func TestGetBearerToken(t *testing.T) {
 		})
 	}
 }
+
+func TestHashToken(t *testing.T) {
+	token, err := MakeToken()
+	if err != nil {
+		t.Fatalf("Failed to make token: %v", err)
+	}
+
+	if HashToken(token) != HashToken(token) {
+		t.Errorf("HashToken() is not deterministic")
+	}
+	if HashToken(token) == token {
+		t.Errorf("HashToken() returned the token unchanged")
+	}
+
+	other, err := MakeToken()
+	if err != nil {
+		t.Fatalf("Failed to make token: %v", err)
+	}
+	if HashToken(token) == HashToken(other) {
+		t.Errorf("HashToken() returned the same hash for different tokens")
+	}
+}
+
+func TestHashRefreshToken(t *testing.T) {
+	key := []byte("refresh-token-key")
+
+	tests := []struct {
+		name      string
+		token     string
+		key       []byte
+		wantEqual bool
+	}{
+		{
+			name:      "Same token and key",
+			token:     "abc123",
+			key:       key,
+			wantEqual: true,
+		},
+		{
+			name:      "Different token",
+			token:     "abc124",
+			key:       key,
+			wantEqual: false,
+		},
+		{
+			name:      "Different key",
+			token:     "abc123",
+			key:       []byte("another-key"),
+			wantEqual: false,
+		},
+	}
+
+	want := HashRefreshToken("abc123", key)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := HashRefreshToken(tt.token, tt.key)
+			if (got == want) != tt.wantEqual {
+				t.Errorf("HashRefreshToken() = %v, compared with %v, wantEqual %v", got, want, tt.wantEqual)
+			}
+			if got == tt.token || got == HashToken(tt.token) {
+				t.Errorf("HashRefreshToken() must be a keyed digest of the token")
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// Token types. Only access tokens are accepted on API requests; other kinds
+// of JWT can't be replayed as one.
+const (
+	TokenTypeAccess = "access"
+	// TokenTypeMFAChallenge proves the password step of a login succeeded
+	// and is exchanged, together with a second factor, for an access token.
+	TokenTypeMFAChallenge = "mfa_challenge"
+)
+
+// Scopes limit what a token may be used for.
+const (
+	ScopeChirpsRead   = "chirps:read"
+	ScopeChirpsWrite  = "chirps:write"
+	ScopeProfileWrite = "profile:write"
+	// ScopeAccount covers credentials and sessions: passwords, email
+	// addresses, verification and logging devices out.
+	ScopeAccount = "account"
+)
+
+// AllScopes is what a user gets by logging in with their password.
+var AllScopes = []string{ScopeChirpsRead, ScopeChirpsWrite, ScopeProfileWrite, ScopeAccount}
+
+// Claims is what an API request is authenticated as.
+type Claims struct {
+	UserID uuid.UUID
+	// SessionID is the login session the token belongs to, or uuid.Nil.
+	SessionID uuid.UUID
+	// ID is the token's jti, used to revoke it before it expires.
+	ID        string
+	Type      string
+	Scopes    []string
+	ExpiresAt time.Time
+}
+
+func (c Claims) HasScope(scope string) bool {
+	return slices.Contains(c.Scopes, scope)
+}
+
+// jwtClaims is the encoded form of Claims.
+type jwtClaims struct {
+	jwt.RegisteredClaims
+	SessionID string `json:"sid,omitempty"`
+	Type      string `json:"token_type"`
+	Scope     string `json:"scope,omitempty"`
+}
+
+func (c *jwtClaims) claims() (Claims, error) {
+	userID, err := uuid.Parse(c.Subject)
+	if err != nil {
+		return Claims{}, err
+	}
+
+	sessionID := uuid.Nil
+	if c.SessionID != "" {
+		sessionID, err = uuid.Parse(c.SessionID)
+		if err != nil {
+			return Claims{}, err
+		}
+	}
+
+	claims := Claims{
+		UserID:    userID,
+		SessionID: sessionID,
+		ID:        c.ID,
+		Type:      c.Type,
+		Scopes:    strings.Fields(c.Scope),
+	}
+	if c.ExpiresAt != nil {
+		claims.ExpiresAt = c.ExpiresAt.Time
+	}
+	return claims, nil
+}
+
+func uuidClaim(id uuid.UUID) string {
+	if id == uuid.Nil {
+		return ""
+	}
+	return id.String()
+}
@@ -0,0 +1,217 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// LegacyKeyID names the key that verifies tokens issued before tokens carried
+// a kid header.
+const LegacyKeyID = "default"
+
+// Key is one JWT key identified by its kid. Keys without a private half can
+// only verify tokens, which is how a retired signing key is kept around
+// until the tokens it signed have expired.
+type Key struct {
+	ID         string
+	method     jwt.SigningMethod
+	signingKey any
+	verifyKey  any
+}
+
+func NewHMACKey(id string, secret []byte) *Key {
+	return &Key{ID: id, method: jwt.SigningMethodHS256, signingKey: secret, verifyKey: secret}
+}
+
+func NewEd25519Key(id string, privateKey ed25519.PrivateKey) *Key {
+	return &Key{ID: id, method: jwt.SigningMethodEdDSA, signingKey: privateKey, verifyKey: privateKey.Public()}
+}
+
+func NewRSAKey(id string, privateKey *rsa.PrivateKey) *Key {
+	return &Key{ID: id, method: jwt.SigningMethodRS256, signingKey: privateKey, verifyKey: &privateKey.PublicKey}
+}
+
+// ParsePEMKey reads an Ed25519 or RSA key from PEM. Private keys may be PKCS
+// #8 or, for RSA, PKCS #1; a PKIX public key gives a verify-only key.
+func ParsePEMKey(id string, data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("key %q: no PEM data found", id)
+	}
+
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", id, err)
+		}
+		switch k := parsed.(type) {
+		case ed25519.PrivateKey:
+			return NewEd25519Key(id, k), nil
+		case *rsa.PrivateKey:
+			return NewRSAKey(id, k), nil
+		}
+		return nil, fmt.Errorf("key %q: unsupported private key type %T", id, parsed)
+	case "RSA PRIVATE KEY":
+		k, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", id, err)
+		}
+		return NewRSAKey(id, k), nil
+	case "PUBLIC KEY":
+		parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", id, err)
+		}
+		switch k := parsed.(type) {
+		case ed25519.PublicKey:
+			return &Key{ID: id, method: jwt.SigningMethodEdDSA, verifyKey: k}, nil
+		case *rsa.PublicKey:
+			return &Key{ID: id, method: jwt.SigningMethodRS256, verifyKey: k}, nil
+		}
+		return nil, fmt.Errorf("key %q: unsupported public key type %T", id, parsed)
+	}
+	return nil, fmt.Errorf("key %q: unsupported PEM block %q", id, block.Type)
+}
+
+// Algorithm returns the JWS alg the key is used with.
+func (k *Key) Algorithm() string {
+	return k.method.Alg()
+}
+
+// DefaultIssuer is the iss and aud of tokens unless configured otherwise.
+const DefaultIssuer = "chirpy"
+
+// Keyring holds every key tokens may be verified with and the one new tokens
+// are signed with. Issuer and Audience are stamped on every token MakeJWT
+// signs and required of every token ValidateJWT accepts.
+type Keyring struct {
+	Issuer   string
+	Audience string
+
+	signing *Key
+	keys    map[string]*Key
+}
+
+func NewKeyring(signingID string, keys ...*Key) (*Keyring, error) {
+	kr := &Keyring{
+		Issuer:   DefaultIssuer,
+		Audience: DefaultIssuer,
+		keys:     make(map[string]*Key, len(keys)),
+	}
+	for _, k := range keys {
+		if k.ID == "" {
+			return nil, errors.New("keyring: key has no ID")
+		}
+		if _, ok := kr.keys[k.ID]; ok {
+			return nil, fmt.Errorf("keyring: duplicate key ID %q", k.ID)
+		}
+		kr.keys[k.ID] = k
+	}
+
+	signing, ok := kr.keys[signingID]
+	if !ok {
+		return nil, fmt.Errorf("keyring: signing key %q not found", signingID)
+	}
+	if signing.signingKey == nil {
+		return nil, fmt.Errorf("keyring: signing key %q has no private key", signingID)
+	}
+	kr.signing = signing
+	return kr, nil
+}
+
+// Sign signs claims with the current signing key and records its kid in the
+// token header.
+func (kr *Keyring) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(kr.signing.method, claims)
+	token.Header["kid"] = kr.signing.ID
+	return token.SignedString(kr.signing.signingKey)
+}
+
+// SigningAlgorithm returns the JWS alg new tokens are signed with.
+func (kr *Keyring) SigningAlgorithm() string {
+	return kr.signing.Algorithm()
+}
+
+// CanSignPublicly reports whether tokens signed now can be verified by
+// others through the JWKS, which isn't possible with an HMAC signing key.
+func (kr *Keyring) CanSignPublicly() bool {
+	_, shared := kr.signing.signingKey.([]byte)
+	return !shared
+}
+
+// keyfunc picks the verification key named by the token's kid. The key also
+// decides the algorithm, so a token can't make an RSA public key be used as
+// an HMAC secret.
+func (kr *Keyring) keyfunc(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		kid = LegacyKeyID
+	}
+	k, ok := kr.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key ID %q", kid)
+	}
+	if token.Method.Alg() != k.Algorithm() {
+		return nil, fmt.Errorf("key %q is used with %s, not %s", kid, k.Algorithm(), token.Method.Alg())
+	}
+	return k.verifyKey, nil
+}
+
+// JWK is the public half of a key in RFC 7517 form.
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS lists the public keys in the keyring, ordered by kid. HMAC keys are
+// shared secrets and are never included.
+func (kr *Keyring) JWKS() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+	for _, k := range kr.keys {
+		switch pub := k.verifyKey.(type) {
+		case ed25519.PublicKey:
+			set.Keys = append(set.Keys, JWK{
+				Kty: "OKP",
+				Use: "sig",
+				Alg: k.Algorithm(),
+				Kid: k.ID,
+				Crv: "Ed25519",
+				X:   base64.RawURLEncoding.EncodeToString(pub),
+			})
+		case *rsa.PublicKey:
+			set.Keys = append(set.Keys, JWK{
+				Kty: "RSA",
+				Use: "sig",
+				Alg: k.Algorithm(),
+				Kid: k.ID,
+				N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+			})
+		}
+	}
+	sort.Slice(set.Keys, func(i, j int) bool {
+		return set.Keys[i].Kid < set.Keys[j].Kid
+	})
+	return set
+}
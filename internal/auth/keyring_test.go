@@ -0,0 +1,298 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func TestKeyringRoundTrip(t *testing.T) {
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate Ed25519 key: %v", err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		key     *Key
+		wantAlg string
+	}{
+		{
+			name:    "HS256",
+			key:     NewHMACKey("hs", []byte("secret")),
+			wantAlg: "HS256",
+		},
+		{
+			name:    "Ed25519",
+			key:     NewEd25519Key("ed", edKey),
+			wantAlg: "EdDSA",
+		},
+		{
+			name:    "RS256",
+			key:     NewRSAKey("rs", rsaKey),
+			wantAlg: "RS256",
+		},
+	}
+
+	userID := uuid.New()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys, err := NewKeyring(tt.key.ID, tt.key)
+			if err != nil {
+				t.Fatalf("NewKeyring() error = %v", err)
+			}
+
+			token, err := MakeJWT(Claims{UserID: userID}, keys, time.Hour)
+			if err != nil {
+				t.Fatalf("MakeJWT() error = %v", err)
+			}
+
+			parsed, _, err := jwt.NewParser().ParseUnverified(token, &jwt.RegisteredClaims{})
+			if err != nil {
+				t.Fatalf("ParseUnverified() error = %v", err)
+			}
+			if parsed.Header["kid"] != tt.key.ID || parsed.Header["alg"] != tt.wantAlg {
+				t.Errorf("header = %v, want kid %q and alg %q", parsed.Header, tt.key.ID, tt.wantAlg)
+			}
+
+			got, err := ValidateJWT(token, keys, TokenTypeAccess)
+			if err != nil {
+				t.Fatalf("ValidateJWT() error = %v", err)
+			}
+			if got.UserID != userID {
+				t.Errorf("ValidateJWT() = %v, want %v", got.UserID, userID)
+			}
+		})
+	}
+}
+
+func TestKeyringRotation(t *testing.T) {
+	_, oldKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate Ed25519 key: %v", err)
+	}
+	_, newKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate Ed25519 key: %v", err)
+	}
+
+	before, err := NewKeyring("2024-01", NewEd25519Key("2024-01", oldKey))
+	if err != nil {
+		t.Fatalf("NewKeyring() error = %v", err)
+	}
+	oldToken, err := MakeJWT(Claims{UserID: uuid.New()}, before, time.Hour)
+	if err != nil {
+		t.Fatalf("MakeJWT() error = %v", err)
+	}
+
+	legacy, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwtClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    DefaultIssuer,
+			Audience:  jwt.ClaimStrings{DefaultIssuer},
+			Subject:   uuid.NewString(),
+			ID:        uuid.NewString(),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+		Type: TokenTypeAccess,
+	}).SignedString([]byte("secret"))
+	if err != nil {
+		t.Fatalf("Failed to sign legacy token: %v", err)
+	}
+
+	retired, err := ParsePEMKey("2024-01", pemPublicKey(t, oldKey.Public()))
+	if err != nil {
+		t.Fatalf("ParsePEMKey() error = %v", err)
+	}
+	after, err := NewKeyring("2024-02",
+		NewEd25519Key("2024-02", newKey),
+		retired,
+		NewHMACKey(LegacyKeyID, []byte("secret")),
+	)
+	if err != nil {
+		t.Fatalf("NewKeyring() error = %v", err)
+	}
+	newToken, err := MakeJWT(Claims{UserID: uuid.New()}, after, time.Hour)
+	if err != nil {
+		t.Fatalf("MakeJWT() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		keys    *Keyring
+		wantErr bool
+	}{
+		{
+			name:  "Token from retired key",
+			token: oldToken,
+			keys:  after,
+		},
+		{
+			name:  "Token from new key",
+			token: newToken,
+			keys:  after,
+		},
+		{
+			name:  "Token without kid",
+			token: legacy,
+			keys:  after,
+		},
+		{
+			name:    "Unknown kid",
+			token:   newToken,
+			keys:    before,
+			wantErr: true,
+		},
+		{
+			name:    "Token without kid and no legacy key",
+			token:   legacy,
+			keys:    before,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ValidateJWT(tt.token, tt.keys, TokenTypeAccess)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateJWT() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestKeyringRejectsAlgorithmMismatch(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %v", err)
+	}
+	keys, err := NewKeyring("rs", NewRSAKey("rs", rsaKey))
+	if err != nil {
+		t.Fatalf("NewKeyring() error = %v", err)
+	}
+
+	// An HS256 token keyed with the public key bytes must not verify
+	// against the RSA key of the same kid.
+	publicPEM := pemPublicKey(t, &rsaKey.PublicKey)
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwtClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    DefaultIssuer,
+			Audience:  jwt.ClaimStrings{DefaultIssuer},
+			Subject:   uuid.NewString(),
+			ID:        uuid.NewString(),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+		Type: TokenTypeAccess,
+	})
+	token.Header["kid"] = "rs"
+	forged, err := token.SignedString(publicPEM)
+	if err != nil {
+		t.Fatalf("Failed to sign forged token: %v", err)
+	}
+
+	if _, err := ValidateJWT(forged, keys, TokenTypeAccess); err == nil {
+		t.Errorf("ValidateJWT() accepted an HS256 token for an RS256 key")
+	}
+}
+
+func TestNewKeyring(t *testing.T) {
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate Ed25519 key: %v", err)
+	}
+	verifyOnly, err := ParsePEMKey("old", pemPublicKey(t, edKey.Public()))
+	if err != nil {
+		t.Fatalf("ParsePEMKey() error = %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		signingID string
+		keys      []*Key
+		wantErr   bool
+	}{
+		{
+			name:      "Valid",
+			signingID: "a",
+			keys:      []*Key{NewHMACKey("a", []byte("x")), verifyOnly},
+		},
+		{
+			name:      "Missing signing key",
+			signingID: "b",
+			keys:      []*Key{NewHMACKey("a", []byte("x"))},
+			wantErr:   true,
+		},
+		{
+			name:      "Duplicate key ID",
+			signingID: "a",
+			keys:      []*Key{NewHMACKey("a", []byte("x")), NewHMACKey("a", []byte("y"))},
+			wantErr:   true,
+		},
+		{
+			name:      "Verify-only signing key",
+			signingID: "old",
+			keys:      []*Key{verifyOnly},
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewKeyring(tt.signingID, tt.keys...)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewKeyring() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate Ed25519 key: %v", err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %v", err)
+	}
+
+	keys, err := NewKeyring("ed",
+		NewEd25519Key("ed", edKey),
+		NewRSAKey("rs", rsaKey),
+		NewHMACKey("hs", []byte("secret")),
+	)
+	if err != nil {
+		t.Fatalf("NewKeyring() error = %v", err)
+	}
+
+	set := keys.JWKS()
+	if len(set.Keys) != 2 {
+		t.Fatalf("JWKS() returned %d keys, want 2 (HMAC keys must not be published)", len(set.Keys))
+	}
+	if got := set.Keys[0]; got.Kid != "ed" || got.Kty != "OKP" || got.Crv != "Ed25519" || got.X == "" {
+		t.Errorf("JWKS() Ed25519 key = %+v", got)
+	}
+	if got := set.Keys[1]; got.Kid != "rs" || got.Kty != "RSA" || got.Alg != "RS256" || got.E != "AQAB" {
+		t.Errorf("JWKS() RSA key = %+v", got)
+	}
+}
+
+func pemPublicKey(t *testing.T, pub any) []byte {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatalf("Failed to marshal public key: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
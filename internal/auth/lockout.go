@@ -0,0 +1,87 @@
+package auth
+
+import "time"
+
+// LockoutPolicy decides how long login attempts are refused after a run of
+// failures. The first FreeAttempts failures cost nothing; after that each
+// failure doubles the wait, starting at BaseDelay and capped at MaxDelay,
+// until LockoutThreshold failures lock the key out for LockoutDuration.
+type LockoutPolicy struct {
+	FreeAttempts     int
+	BaseDelay        time.Duration
+	MaxDelay         time.Duration
+	LockoutThreshold int
+	LockoutDuration  time.Duration
+	// Window is how long failures are remembered. A failure more than
+	// Window after the previous one starts a new count.
+	Window time.Duration
+}
+
+// DefaultAccountLockoutPolicy applies to attempts against one email address.
+var DefaultAccountLockoutPolicy = LockoutPolicy{
+	FreeAttempts:     3,
+	BaseDelay:        time.Second,
+	MaxDelay:         time.Minute,
+	LockoutThreshold: 10,
+	LockoutDuration:  15 * time.Minute,
+	Window:           time.Hour,
+}
+
+// DefaultIPLockoutPolicy applies to attempts from one IP address, which may
+// be shared by many legitimate users.
+var DefaultIPLockoutPolicy = LockoutPolicy{
+	FreeAttempts:     20,
+	BaseDelay:        time.Second,
+	MaxDelay:         time.Minute,
+	LockoutThreshold: 100,
+	LockoutDuration:  time.Hour,
+	Window:           time.Hour,
+}
+
+// DefaultResetEmailPolicy applies to the password reset mails sent to one
+// address. Every mail counts, so it limits how much mail the address can be
+// sent; hitting it only holds back mail, never the reset itself.
+var DefaultResetEmailPolicy = LockoutPolicy{
+	FreeAttempts:     3,
+	BaseDelay:        time.Minute,
+	MaxDelay:         15 * time.Minute,
+	LockoutThreshold: 10,
+	LockoutDuration:  time.Hour,
+	Window:           time.Hour,
+}
+
+// DefaultResetIPPolicy applies to password reset requests from one IP
+// address.
+var DefaultResetIPPolicy = LockoutPolicy{
+	FreeAttempts:     10,
+	BaseDelay:        time.Minute,
+	MaxDelay:         15 * time.Minute,
+	LockoutThreshold: 50,
+	LockoutDuration:  24 * time.Hour,
+	Window:           time.Hour,
+}
+
+// Backoff returns how long to refuse attempts after the given number of
+// consecutive failures.
+func (p LockoutPolicy) Backoff(failures int) time.Duration {
+	if failures >= p.LockoutThreshold {
+		return p.LockoutDuration
+	}
+	if failures < p.FreeAttempts {
+		return 0
+	}
+	delay := p.BaseDelay
+	for i := p.FreeAttempts; i < failures; i++ {
+		delay *= 2
+		if delay >= p.MaxDelay {
+			return p.MaxDelay
+		}
+	}
+	return delay
+}
+
+// LockedOut reports whether failures is enough for a full lockout rather
+// than a delay.
+func (p LockoutPolicy) LockedOut(failures int) bool {
+	return failures >= p.LockoutThreshold
+}
@@ -0,0 +1,42 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLockoutPolicyBackoff(t *testing.T) {
+	policy := LockoutPolicy{
+		FreeAttempts:     3,
+		BaseDelay:        time.Second,
+		MaxDelay:         10 * time.Second,
+		LockoutThreshold: 8,
+		LockoutDuration:  15 * time.Minute,
+	}
+
+	tests := []struct {
+		name     string
+		failures int
+		want     time.Duration
+		wantLock bool
+	}{
+		{name: "No failures", failures: 0, want: 0},
+		{name: "Free attempts", failures: 2, want: 0},
+		{name: "First delay", failures: 3, want: time.Second},
+		{name: "Doubling", failures: 5, want: 4 * time.Second},
+		{name: "Capped", failures: 7, want: 10 * time.Second},
+		{name: "Locked out", failures: 8, want: 15 * time.Minute, wantLock: true},
+		{name: "Still locked out", failures: 50, want: 15 * time.Minute, wantLock: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.Backoff(tt.failures); got != tt.want {
+				t.Errorf("Backoff(%d) = %v, want %v", tt.failures, got, tt.want)
+			}
+			if got := policy.LockedOut(tt.failures); got != tt.wantLock {
+				t.Errorf("LockedOut(%d) = %v, want %v", tt.failures, got, tt.wantLock)
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// OpenID Connect scopes. They only ever appear on tokens issued to OAuth
+// clients.
+const (
+	ScopeOpenID  = "openid"
+	ScopeEmail   = "email"
+	ScopeProfile = "profile"
+)
+
+// OAuthScopes are the scopes third-party applications may ask for. Like
+// personal access tokens, they never get ScopeAccount.
+var OAuthScopes = []string{ScopeOpenID, ScopeEmail, ScopeProfile, ScopeChirpsRead, ScopeChirpsWrite, ScopeProfileWrite}
+
+// ParseScope splits a space-separated OAuth scope parameter, dropping
+// duplicates.
+func ParseScope(scope string) []string {
+	var scopes []string
+	for _, s := range strings.Fields(scope) {
+		if !slices.Contains(scopes, s) {
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes
+}
+
+// ValidateOAuthScopes checks that scopes only names scopes in allowed, and
+// returns it without duplicates.
+func ValidateOAuthScopes(scopes, allowed []string) ([]string, error) {
+	var out []string
+	for _, scope := range scopes {
+		if !slices.Contains(allowed, scope) {
+			return nil, fmt.Errorf("unknown scope %q", scope)
+		}
+		if !slices.Contains(out, scope) {
+			out = append(out, scope)
+		}
+	}
+	return out, nil
+}
+
+// ValidateRedirectURI checks a client's redirect URI: an absolute URL
+// without a fragment that is https, http on a loopback address, or a
+// private-use scheme such as com.example.app for native apps (RFC 8252).
+func ValidateRedirectURI(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("invalid redirect URI %q: %w", raw, err)
+	}
+	if !u.IsAbs() {
+		return fmt.Errorf("redirect URI %q must be absolute", raw)
+	}
+	if u.Fragment != "" || strings.Contains(raw, "#") {
+		return fmt.Errorf("redirect URI %q must not have a fragment", raw)
+	}
+
+	switch u.Scheme {
+	case "https":
+		if u.Host == "" {
+			return fmt.Errorf("redirect URI %q has no host", raw)
+		}
+		return nil
+	case "http":
+		host := u.Hostname()
+		if ip := net.ParseIP(host); host == "localhost" || (ip != nil && ip.IsLoopback()) {
+			return nil
+		}
+		return fmt.Errorf("redirect URI %q must use https unless it is a loopback address", raw)
+	}
+	if strings.Contains(u.Scheme, ".") {
+		return nil
+	}
+	return fmt.Errorf("redirect URI %q has unsupported scheme %q", raw, u.Scheme)
+}
+
+// PKCE (RFC 7636). Only the S256 method is supported.
+const PKCEMethodS256 = "S256"
+
+// PKCEChallenge returns the S256 code challenge for verifier.
+func PKCEChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// ValidatePKCEChallenge checks that challenge looks like an S256 code
+// challenge: a base64url SHA-256.
+func ValidatePKCEChallenge(challenge string) error {
+	b, err := base64.RawURLEncoding.DecodeString(challenge)
+	if err != nil || len(b) != sha256.Size {
+		return errors.New("code_challenge must be a base64url encoded SHA-256")
+	}
+	return nil
+}
+
+// VerifyPKCE reports whether verifier is a well-formed code verifier whose
+// S256 challenge is challenge.
+func VerifyPKCE(verifier, challenge string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	for _, c := range verifier {
+		if !(c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || strings.ContainsRune("-._~", c)) {
+			return false
+		}
+	}
+	return subtle.ConstantTimeCompare([]byte(PKCEChallenge(verifier)), []byte(challenge)) == 1
+}
+
+// UserInfo holds the OpenID Connect standard claims about a user that a
+// client's scopes allow it to see.
+type UserInfo struct {
+	Subject           string `json:"sub"`
+	Email             string `json:"email,omitempty"`
+	EmailVerified     *bool  `json:"email_verified,omitempty"`
+	Name              string `json:"name,omitempty"`
+	PreferredUsername string `json:"preferred_username,omitempty"`
+	Picture           string `json:"picture,omitempty"`
+}
+
+// IDTokenClaims is the payload of an OpenID Connect ID token.
+type IDTokenClaims struct {
+	jwt.RegisteredClaims
+	AuthorizedParty   string `json:"azp,omitempty"`
+	Nonce             string `json:"nonce,omitempty"`
+	Email             string `json:"email,omitempty"`
+	EmailVerified     *bool  `json:"email_verified,omitempty"`
+	Name              string `json:"name,omitempty"`
+	PreferredUsername string `json:"preferred_username,omitempty"`
+	Picture           string `json:"picture,omitempty"`
+}
+
+// MakeIDToken signs an ID token about info for the client clientID. The
+// keyring's issuer is the iss and the client is the only audience, so an ID
+// token is never accepted as an access token.
+func MakeIDToken(info UserInfo, clientID, nonce string, keys *Keyring, expiresIn time.Duration) (string, error) {
+	now := time.Now().UTC()
+	return keys.Sign(IDTokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    keys.Issuer,
+			Audience:  jwt.ClaimStrings{clientID},
+			Subject:   info.Subject,
+			ID:        uuid.NewString(),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(expiresIn)),
+		},
+		Nonce:             nonce,
+		Email:             info.Email,
+		EmailVerified:     info.EmailVerified,
+		Name:              info.Name,
+		PreferredUsername: info.PreferredUsername,
+		Picture:           info.Picture,
+	})
+}
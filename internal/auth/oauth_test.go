@@ -0,0 +1,119 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func TestValidateRedirectURI(t *testing.T) {
+	tests := []struct {
+		name    string
+		uri     string
+		wantErr bool
+	}{
+		{name: "HTTPS", uri: "https://app.example.com/callback", wantErr: false},
+		{name: "HTTPS with query", uri: "https://app.example.com/callback?x=1", wantErr: false},
+		{name: "Loopback IPv4", uri: "http://127.0.0.1:8080/callback", wantErr: false},
+		{name: "Loopback IPv6", uri: "http://[::1]/callback", wantErr: false},
+		{name: "Localhost", uri: "http://localhost:3000/callback", wantErr: false},
+		{name: "Private-use scheme", uri: "com.example.app:/callback", wantErr: false},
+		{name: "Plain HTTP", uri: "http://app.example.com/callback", wantErr: true},
+		{name: "Relative", uri: "/callback", wantErr: true},
+		{name: "Fragment", uri: "https://app.example.com/callback#frag", wantErr: true},
+		{name: "JavaScript", uri: "javascript:alert(1)", wantErr: true},
+		{name: "HTTPS without host", uri: "https:///callback", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateRedirectURI(tt.uri)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateRedirectURI(%q) error = %v, wantErr %v", tt.uri, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyPKCE(t *testing.T) {
+	verifier := "dBjftJeZ4CVP-mJ92K1D8F6NPA_ANz-xk9n2xZeJNZ0"
+	challenge := "AenEw-rBLdz9zfXB7ZCWbZyqmdZjHnhUmDY6ZpgdhqQ"
+
+	if got := PKCEChallenge(verifier); got != challenge {
+		t.Fatalf("PKCEChallenge() = %q, want %q", got, challenge)
+	}
+	if err := ValidatePKCEChallenge(challenge); err != nil {
+		t.Errorf("ValidatePKCEChallenge() error = %v", err)
+	}
+	if err := ValidatePKCEChallenge("plain-verifier"); err == nil {
+		t.Errorf("ValidatePKCEChallenge() accepted a value that isn't a SHA-256")
+	}
+
+	tests := []struct {
+		name     string
+		verifier string
+		want     bool
+	}{
+		{name: "Matching verifier", verifier: verifier, want: true},
+		{name: "Other verifier", verifier: strings.Repeat("a", 43), want: false},
+		{name: "Too short", verifier: verifier[:42], want: false},
+		{name: "Too long", verifier: strings.Repeat("a", 129), want: false},
+		{name: "Invalid characters", verifier: verifier[:42] + "+", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := VerifyPKCE(tt.verifier, challenge); got != tt.want {
+				t.Errorf("VerifyPKCE() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMakeIDToken(t *testing.T) {
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate Ed25519 key: %v", err)
+	}
+	keys, err := NewKeyring("ed", NewEd25519Key("ed", edKey))
+	if err != nil {
+		t.Fatalf("NewKeyring() error = %v", err)
+	}
+	keys.Issuer = "https://chirpy.example.com"
+
+	verified := true
+	info := UserInfo{Subject: uuid.NewString(), Email: "walt@example.com", EmailVerified: &verified}
+	token, err := MakeIDToken(info, "client-1", "n-0S6_WzA2Mj", keys, time.Minute)
+	if err != nil {
+		t.Fatalf("MakeIDToken() error = %v", err)
+	}
+
+	var claims IDTokenClaims
+	_, err = jwt.ParseWithClaims(token, &claims, keys.keyfunc,
+		jwt.WithIssuer(keys.Issuer),
+		jwt.WithAudience("client-1"),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		t.Fatalf("Parsing ID token failed: %v", err)
+	}
+	if claims.Subject != info.Subject || claims.Nonce != "n-0S6_WzA2Mj" || claims.Email != info.Email ||
+		claims.EmailVerified == nil || !*claims.EmailVerified {
+		t.Errorf("ID token claims = %+v, want %+v with the nonce", claims, info)
+	}
+
+	if _, err := ValidateJWT(token, keys, TokenTypeAccess); err == nil {
+		t.Errorf("ValidateJWT() accepted an ID token as an access token")
+	}
+	if !keys.CanSignPublicly() {
+		t.Errorf("CanSignPublicly() = false for an Ed25519 signing key")
+	}
+	if hmacKeyring(t, "secret").CanSignPublicly() {
+		t.Errorf("CanSignPublicly() = true for an HMAC signing key")
+	}
+}
@@ -0,0 +1,55 @@
+package auth
+
+import (
+	"runtime"
+
+	"github.com/alexedwards/argon2id"
+)
+
+// PasswordParams are the argon2id settings new password hashes are made
+// with. Memory is in KiB; lengths are in bytes.
+type PasswordParams struct {
+	Memory      uint32 `json:"memory"`
+	Iterations  uint32 `json:"iterations"`
+	Parallelism uint8  `json:"parallelism"`
+	SaltLength  uint32 `json:"salt_length"`
+	KeyLength   uint32 `json:"key_length"`
+}
+
+// DefaultPasswordParams returns the argon2id library's recommended
+// settings: 64 MiB, one pass, one lane per CPU, a 16 byte salt and a 32 byte
+// key.
+func DefaultPasswordParams() PasswordParams {
+	return PasswordParams{
+		Memory:      64 * 1024,
+		Iterations:  1,
+		Parallelism: uint8(runtime.NumCPU()),
+		SaltLength:  16,
+		KeyLength:   32,
+	}
+}
+
+func (p PasswordParams) argon2id() *argon2id.Params {
+	return &argon2id.Params{
+		Memory:      p.Memory,
+		Iterations:  p.Iterations,
+		Parallelism: p.Parallelism,
+		SaltLength:  p.SaltLength,
+		KeyLength:   p.KeyLength,
+	}
+}
+
+// NeedsRehash reports whether hash was made with weaker settings than
+// params: less memory, fewer iterations or a shorter salt or key.
+// Parallelism is ignored because the default follows the CPU count, which
+// would otherwise rehash every password whenever the server moves.
+func NeedsRehash(hash string, params PasswordParams) (bool, error) {
+	current, salt, key, err := argon2id.DecodeHash(hash)
+	if err != nil {
+		return false, err
+	}
+	return current.Memory < params.Memory ||
+		current.Iterations < params.Iterations ||
+		uint32(len(salt)) < params.SaltLength ||
+		uint32(len(key)) < params.KeyLength, nil
+}
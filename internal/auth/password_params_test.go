@@ -0,0 +1,80 @@
+package auth
+
+import "testing"
+
+func TestNeedsRehash(t *testing.T) {
+	weak := PasswordParams{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 8, KeyLength: 16}
+	hash, err := HashPassword("correctPassword123!", weak)
+	if err != nil {
+		t.Fatalf("Failed to hash password: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		hash    string
+		params  PasswordParams
+		want    bool
+		wantErr bool
+	}{
+		{
+			name:   "Same parameters",
+			hash:   hash,
+			params: weak,
+			want:   false,
+		},
+		{
+			name:   "Weaker target",
+			hash:   hash,
+			params: PasswordParams{Memory: 512, Iterations: 1, Parallelism: 1, SaltLength: 8, KeyLength: 16},
+			want:   false,
+		},
+		{
+			name:   "Different parallelism only",
+			hash:   hash,
+			params: PasswordParams{Memory: 1024, Iterations: 1, Parallelism: 4, SaltLength: 8, KeyLength: 16},
+			want:   false,
+		},
+		{
+			name:   "More memory",
+			hash:   hash,
+			params: PasswordParams{Memory: 2048, Iterations: 1, Parallelism: 1, SaltLength: 8, KeyLength: 16},
+			want:   true,
+		},
+		{
+			name:   "More iterations",
+			hash:   hash,
+			params: PasswordParams{Memory: 1024, Iterations: 2, Parallelism: 1, SaltLength: 8, KeyLength: 16},
+			want:   true,
+		},
+		{
+			name:   "Longer salt",
+			hash:   hash,
+			params: PasswordParams{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 16},
+			want:   true,
+		},
+		{
+			name:   "Longer key",
+			hash:   hash,
+			params: PasswordParams{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 8, KeyLength: 32},
+			want:   true,
+		},
+		{
+			name:    "Invalid hash",
+			hash:    "invalidhash",
+			params:  weak,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NeedsRehash(tt.hash, tt.params)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NeedsRehash() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("NeedsRehash() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,204 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/sha1"
+	_ "embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Codes for the ways a password can fail a PasswordPolicy.
+const (
+	PasswordTooShort     = "too_short"
+	PasswordTooLong      = "too_long"
+	PasswordCommon       = "common"
+	PasswordMatchesEmail = "matches_email"
+	PasswordBreached     = "breached"
+)
+
+// PasswordViolation is one reason a password was rejected, in a form that
+// can be returned to the client as is.
+type PasswordViolation struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// PasswordPolicy decides which passwords users may choose. Lengths count
+// characters, not bytes. Banned holds lowercased passwords that are refused
+// outright, and Breached, if set, is a local copy of a breached password
+// list to check against.
+type PasswordPolicy struct {
+	MinLength int
+	MaxLength int
+	Banned    map[string]bool
+	Breached  *PwnedPasswords
+}
+
+//go:embed common_passwords.txt
+var commonPasswords string
+
+// commonPasswordList is the embedded list, parsed once.
+var commonPasswordList = parsePasswordList(commonPasswords)
+
+// DefaultPasswordPolicy returns the policy used when nothing is configured:
+// 8 to 128 characters and none of the built-in common passwords. Banned is
+// the caller's own copy, so it may be added to.
+func DefaultPasswordPolicy() PasswordPolicy {
+	return PasswordPolicy{
+		MinLength: 8,
+		MaxLength: 128,
+		Banned:    maps.Clone(commonPasswordList),
+	}
+}
+
+// ReadPasswordList reads one password per line, skipping blank lines and
+// lines starting with #, into a set of lowercased passwords.
+func ReadPasswordList(r io.Reader) (map[string]bool, error) {
+	passwords := map[string]bool{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		addPasswordLine(passwords, scanner.Text())
+	}
+	return passwords, scanner.Err()
+}
+
+// parsePasswordList is ReadPasswordList for a list already in memory, which
+// can't fail.
+func parsePasswordList(list string) map[string]bool {
+	passwords := map[string]bool{}
+	for _, line := range strings.Split(list, "\n") {
+		addPasswordLine(passwords, line)
+	}
+	return passwords
+}
+
+func addPasswordLine(passwords map[string]bool, line string) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return
+	}
+	passwords[strings.ToLower(line)] = true
+}
+
+// Check returns every way password breaks the policy, or nothing if it is
+// acceptable. email is the account's address; passwords equal to it or to
+// its local part are refused. An error means the breached password list
+// couldn't be read.
+func (p PasswordPolicy) Check(password, email string) ([]PasswordViolation, error) {
+	var violations []PasswordViolation
+
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		violations = append(violations, PasswordViolation{
+			Code:    PasswordTooShort,
+			Message: fmt.Sprintf("Password must be at least %d characters long", p.MinLength),
+		})
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		violations = append(violations, PasswordViolation{
+			Code:    PasswordTooLong,
+			Message: fmt.Sprintf("Password must be at most %d characters long", p.MaxLength),
+		})
+		// Don't spend time hashing or looking up something this long.
+		return violations, nil
+	}
+
+	if p.Banned[strings.ToLower(password)] {
+		violations = append(violations, PasswordViolation{
+			Code:    PasswordCommon,
+			Message: "Password is too common",
+		})
+	}
+
+	if email != "" {
+		local, _, _ := strings.Cut(email, "@")
+		if strings.EqualFold(password, email) || strings.EqualFold(password, local) {
+			violations = append(violations, PasswordViolation{
+				Code:    PasswordMatchesEmail,
+				Message: "Password must not be your email address",
+			})
+		}
+	}
+
+	if p.Breached != nil && password != "" {
+		breached, err := p.Breached.Contains(password)
+		if err != nil {
+			return nil, err
+		}
+		if breached {
+			violations = append(violations, PasswordViolation{
+				Code:    PasswordBreached,
+				Message: "Password has appeared in a data breach",
+			})
+		}
+	}
+
+	return violations, nil
+}
+
+// PwnedPasswords looks passwords up in a local copy of the Have I Been Pwned
+// password list, stored the way the range API serves it: Dir holds one file
+// per five-character SHA-1 prefix, named PREFIX.txt or just PREFIX, and each
+// line of a file is the remaining 35 characters of a hash, a colon and the
+// number of times it was seen.
+type PwnedPasswords struct {
+	Dir string
+	// MinCount is how many sightings make a password count as breached.
+	// Zero means one.
+	MinCount int
+}
+
+// Contains reports whether password appears in the list at least MinCount
+// times. A prefix with no file is treated as having no breached passwords,
+// so a partial copy of the list can be used.
+func (p *PwnedPasswords) Contains(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	minCount := p.MinCount
+	if minCount < 1 {
+		minCount = 1
+	}
+
+	f, err := p.open(prefix)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		entry, countText, ok := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if !ok || !strings.EqualFold(entry, suffix) {
+			continue
+		}
+		count, err := strconv.Atoi(countText)
+		if err != nil {
+			return false, fmt.Errorf("pwned passwords %s: invalid count %q", prefix, countText)
+		}
+		return count >= minCount, nil
+	}
+	return false, scanner.Err()
+}
+
+func (p *PwnedPasswords) open(prefix string) (*os.File, error) {
+	f, err := os.Open(filepath.Join(p.Dir, prefix+".txt"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return os.Open(filepath.Join(p.Dir, prefix))
+	}
+	return f, err
+}
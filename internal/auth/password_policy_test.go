@@ -0,0 +1,162 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPasswordPolicyCheck(t *testing.T) {
+	// SHA-1 of "correct horse battery staple" is
+	// ABF7AAD6438836DBE526AA231ABDE2D0EEF74D42.
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "ABF7A.txt"),
+		[]byte("0000000000000000000000000000000000A:3\r\nAD6438836DBE526AA231ABDE2D0EEF74D42:42\r\n"), 0o600)
+	if err != nil {
+		t.Fatalf("Failed to write pwned passwords file: %v", err)
+	}
+
+	policy := DefaultPasswordPolicy()
+	policy.Breached = &PwnedPasswords{Dir: dir}
+
+	tests := []struct {
+		name      string
+		password  string
+		email     string
+		wantCodes []string
+	}{
+		{
+			name:      "Acceptable password",
+			password:  "purple-otter-quietly-77",
+			email:     "walt@example.com",
+			wantCodes: nil,
+		},
+		{
+			name:      "Empty password",
+			password:  "",
+			email:     "walt@example.com",
+			wantCodes: []string{PasswordTooShort},
+		},
+		{
+			name:      "Too short",
+			password:  "x7#kq",
+			email:     "walt@example.com",
+			wantCodes: []string{PasswordTooShort},
+		},
+		{
+			name:      "Length counts characters",
+			password:  "ééééééé",
+			email:     "walt@example.com",
+			wantCodes: []string{PasswordTooShort},
+		},
+		{
+			name:      "Too long",
+			password:  strings.Repeat("a", 129),
+			email:     "walt@example.com",
+			wantCodes: []string{PasswordTooLong},
+		},
+		{
+			name:      "Common password",
+			password:  "Password123",
+			email:     "walt@example.com",
+			wantCodes: []string{PasswordCommon},
+		},
+		{
+			name:      "Short and common",
+			password:  "abc123",
+			email:     "walt@example.com",
+			wantCodes: []string{PasswordTooShort, PasswordCommon},
+		},
+		{
+			name:      "Same as email",
+			password:  "Walter.White@example.com",
+			email:     "walter.white@example.com",
+			wantCodes: []string{PasswordMatchesEmail},
+		},
+		{
+			name:      "Same as email local part",
+			password:  "walter.white",
+			email:     "walter.white@example.com",
+			wantCodes: []string{PasswordMatchesEmail},
+		},
+		{
+			name:      "Breached password",
+			password:  "correct horse battery staple",
+			email:     "walt@example.com",
+			wantCodes: []string{PasswordBreached},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			violations, err := policy.Check(tt.password, tt.email)
+			if err != nil {
+				t.Fatalf("Check() error = %v", err)
+			}
+			var codes []string
+			for _, v := range violations {
+				codes = append(codes, v.Code)
+				if v.Message == "" {
+					t.Errorf("Check() violation %q has no message", v.Code)
+				}
+			}
+			if strings.Join(codes, ",") != strings.Join(tt.wantCodes, ",") {
+				t.Errorf("Check() codes = %v, want %v", codes, tt.wantCodes)
+			}
+		})
+	}
+}
+
+func TestPwnedPasswordsContains(t *testing.T) {
+	dir := t.TempDir()
+	// Files without the .txt extension are accepted too.
+	err := os.WriteFile(filepath.Join(dir, "ABF7A"),
+		[]byte("ad6438836dbe526aa231abde2d0eef74d42:2\n"), 0o600)
+	if err != nil {
+		t.Fatalf("Failed to write pwned passwords file: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		password string
+		minCount int
+		want     bool
+	}{
+		{
+			name:     "Listed password",
+			password: "correct horse battery staple",
+			want:     true,
+		},
+		{
+			name:     "Listed too few times",
+			password: "correct horse battery staple",
+			minCount: 3,
+			want:     false,
+		},
+		{
+			name:     "Prefix without a file",
+			password: "purple-otter-quietly-77",
+			want:     false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pwned := &PwnedPasswords{Dir: dir, MinCount: tt.minCount}
+			got, err := pwned.Contains(tt.password)
+			if err != nil {
+				t.Fatalf("Contains() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Contains() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHashPasswordEmpty(t *testing.T) {
+	if _, err := HashPassword("", DefaultPasswordParams()); err != ErrEmptyPassword {
+		t.Errorf("HashPassword(\"\") error = %v, want %v", err, ErrEmptyPassword)
+	}
+}
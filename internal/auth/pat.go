@@ -0,0 +1,48 @@
+package auth
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// PersonalAccessTokenPrefix starts every personal access token so they can
+// be told apart from JWTs and spotted by secret scanners.
+const PersonalAccessTokenPrefix = "chirpy_pat_"
+
+// TokenTypePersonal marks claims that came from a personal access token.
+const TokenTypePersonal = "personal"
+
+// PersonalAccessTokenScopes are the scopes a personal access token may be
+// granted. Account management always needs a password login.
+var PersonalAccessTokenScopes = []string{ScopeChirpsRead, ScopeChirpsWrite, ScopeProfileWrite}
+
+func MakePersonalAccessToken() (string, error) {
+	token, err := MakeToken()
+	if err != nil {
+		return "", err
+	}
+	return PersonalAccessTokenPrefix + token, nil
+}
+
+func IsPersonalAccessToken(token string) bool {
+	return strings.HasPrefix(token, PersonalAccessTokenPrefix)
+}
+
+// ValidatePersonalAccessTokenScopes checks that scopes is non-empty and only
+// names grantable scopes, and returns it without duplicates.
+func ValidatePersonalAccessTokenScopes(scopes []string) ([]string, error) {
+	if len(scopes) == 0 {
+		return nil, fmt.Errorf("at least one scope is required")
+	}
+	var out []string
+	for _, scope := range scopes {
+		if !slices.Contains(PersonalAccessTokenScopes, scope) {
+			return nil, fmt.Errorf("unknown scope %q", scope)
+		}
+		if !slices.Contains(out, scope) {
+			out = append(out, scope)
+		}
+	}
+	return out, nil
+}
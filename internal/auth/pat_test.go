@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMakePersonalAccessToken(t *testing.T) {
+	token, err := MakePersonalAccessToken()
+	if err != nil {
+		t.Fatalf("MakePersonalAccessToken() error = %v", err)
+	}
+	if !IsPersonalAccessToken(token) {
+		t.Errorf("MakePersonalAccessToken() = %q, want prefix %q", token, PersonalAccessTokenPrefix)
+	}
+
+	jwt, err := MakeJWT(Claims{}, hmacKeyring(t, "secret"), 0)
+	if err != nil {
+		t.Fatalf("MakeJWT() error = %v", err)
+	}
+	if IsPersonalAccessToken(jwt) {
+		t.Errorf("IsPersonalAccessToken() = true for a JWT")
+	}
+}
+
+func TestValidatePersonalAccessTokenScopes(t *testing.T) {
+	tests := []struct {
+		name    string
+		scopes  []string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:   "Valid scopes",
+			scopes: []string{ScopeChirpsRead, ScopeChirpsWrite},
+			want:   []string{ScopeChirpsRead, ScopeChirpsWrite},
+		},
+		{
+			name:   "Duplicates removed",
+			scopes: []string{ScopeProfileWrite, ScopeProfileWrite},
+			want:   []string{ScopeProfileWrite},
+		},
+		{
+			name:    "No scopes",
+			scopes:  nil,
+			wantErr: true,
+		},
+		{
+			name:    "Account scope",
+			scopes:  []string{ScopeChirpsRead, ScopeAccount},
+			wantErr: true,
+		},
+		{
+			name:    "Unknown scope",
+			scopes:  []string{"chirps:delete"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ValidatePersonalAccessTokenScopes(tt.scopes)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ValidatePersonalAccessTokenScopes() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ValidatePersonalAccessTokenScopes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
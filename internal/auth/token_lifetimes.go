@@ -0,0 +1,38 @@
+package auth
+
+import "time"
+
+// TokenLifetimes bounds how long the tokens issued to one plan stay valid.
+type TokenLifetimes struct {
+	AccessTTL    time.Duration
+	MaxAccessTTL time.Duration
+	RefreshTTL   time.Duration
+}
+
+// AccessTTLFor returns the lifetime for a new access token. Clients may ask
+// for a specific lifetime in seconds; anything longer than the plan allows
+// is cut down to the maximum, and zero or less means the default.
+func (l TokenLifetimes) AccessTTLFor(requestedSeconds int) time.Duration {
+	if requestedSeconds <= 0 {
+		return l.AccessTTL
+	}
+	if int64(requestedSeconds) > int64(l.MaxAccessTTL/time.Second) {
+		return l.MaxAccessTTL
+	}
+	return time.Duration(requestedSeconds) * time.Second
+}
+
+// PlanTokenLifetimes holds the token lifetimes for each plan.
+type PlanTokenLifetimes struct {
+	Standard  TokenLifetimes
+	ChirpyRed TokenLifetimes
+}
+
+// For returns the lifetimes for a user who is on Chirpy Red if red is true,
+// or on the standard plan otherwise.
+func (p PlanTokenLifetimes) For(red bool) TokenLifetimes {
+	if red {
+		return p.ChirpyRed
+	}
+	return p.Standard
+}
@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestAccessTTLFor(t *testing.T) {
+	plans := PlanTokenLifetimes{
+		Standard: TokenLifetimes{
+			AccessTTL:    time.Hour,
+			MaxAccessTTL: 2 * time.Hour,
+			RefreshTTL:   60 * 24 * time.Hour,
+		},
+		ChirpyRed: TokenLifetimes{
+			AccessTTL:    time.Hour,
+			MaxAccessTTL: 24 * time.Hour,
+			RefreshTTL:   90 * 24 * time.Hour,
+		},
+	}
+
+	tests := []struct {
+		name      string
+		red       bool
+		requested int
+		want      time.Duration
+	}{
+		{
+			name:      "Zero means the default",
+			requested: 0,
+			want:      time.Hour,
+		},
+		{
+			name:      "Negative means the default",
+			requested: -30,
+			want:      time.Hour,
+		},
+		{
+			name:      "Shorter than the default",
+			requested: 60,
+			want:      time.Minute,
+		},
+		{
+			name:      "Exactly the maximum",
+			requested: 2 * 60 * 60,
+			want:      2 * time.Hour,
+		},
+		{
+			name:      "Above the maximum",
+			requested: 3 * 60 * 60,
+			want:      2 * time.Hour,
+		},
+		{
+			name:      "Too large for a Duration",
+			requested: math.MaxInt,
+			want:      2 * time.Hour,
+		},
+		{
+			name:      "Chirpy Red default",
+			red:       true,
+			requested: 0,
+			want:      time.Hour,
+		},
+		{
+			name:      "Chirpy Red above the standard maximum",
+			red:       true,
+			requested: 3 * 60 * 60,
+			want:      3 * time.Hour,
+		},
+		{
+			name:      "Chirpy Red above its maximum",
+			red:       true,
+			requested: 48 * 60 * 60,
+			want:      24 * time.Hour,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := plans.For(tt.red).AccessTTLFor(tt.requested)
+			if got != tt.want {
+				t.Errorf("AccessTTLFor(%d) = %v, want %v", tt.requested, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlanTokenLifetimesFor(t *testing.T) {
+	plans := PlanTokenLifetimes{
+		Standard:  TokenLifetimes{RefreshTTL: 60 * 24 * time.Hour},
+		ChirpyRed: TokenLifetimes{RefreshTTL: 90 * 24 * time.Hour},
+	}
+
+	if got := plans.For(false).RefreshTTL; got != 60*24*time.Hour {
+		t.Errorf("For(false).RefreshTTL = %v, want the standard plan's", got)
+	}
+	if got := plans.For(true).RefreshTTL; got != 90*24*time.Hour {
+		t.Errorf("For(true).RefreshTTL = %v, want Chirpy Red's", got)
+	}
+}
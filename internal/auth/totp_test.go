@@ -0,0 +1,128 @@
+package auth
+
+import (
+	"encoding/base32"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA-1 test key from RFC 6238 appendix B.
+var rfc6238Secret = base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestTOTPCode(t *testing.T) {
+	tests := []struct {
+		name string
+		unix int64
+		want string
+	}{
+		{name: "T=59", unix: 59, want: "287082"},
+		{name: "T=1111111109", unix: 1111111109, want: "081804"},
+		{name: "T=1111111111", unix: 1111111111, want: "050471"},
+		{name: "T=1234567890", unix: 1234567890, want: "005924"},
+		{name: "T=2000000000", unix: 2000000000, want: "279037"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := TOTPCode(rfc6238Secret, TOTPStep(time.Unix(tt.unix, 0)))
+			if err != nil {
+				t.Fatalf("TOTPCode() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("TOTPCode() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	now := time.Unix(1111111109, 0)
+	step := TOTPStep(now)
+
+	code := func(step int64) string {
+		c, err := TOTPCode(rfc6238Secret, step)
+		if err != nil {
+			t.Fatalf("TOTPCode() error = %v", err)
+		}
+		return c
+	}
+
+	tests := []struct {
+		name     string
+		code     string
+		wantStep int64
+		wantOK   bool
+	}{
+		{name: "Current code", code: code(step), wantStep: step, wantOK: true},
+		{name: "Previous period", code: code(step - 1), wantStep: step - 1, wantOK: true},
+		{name: "Next period", code: code(step + 1), wantStep: step + 1, wantOK: true},
+		{name: "Too old", code: code(step - 2), wantOK: false},
+		{name: "Spaces ignored", code: code(step)[:3] + " " + code(step)[3:], wantStep: step, wantOK: true},
+		{name: "Wrong length", code: "12345", wantOK: false},
+		{name: "Wrong code", code: "000000", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotStep, gotOK := ValidateTOTP(rfc6238Secret, tt.code, now)
+			if gotOK != tt.wantOK {
+				t.Fatalf("ValidateTOTP() ok = %v, want %v", gotOK, tt.wantOK)
+			}
+			if gotOK && gotStep != tt.wantStep {
+				t.Errorf("ValidateTOTP() step = %v, want %v", gotStep, tt.wantStep)
+			}
+		})
+	}
+}
+
+func TestGenerateTOTPSecret(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("GenerateTOTPSecret() error = %v", err)
+	}
+	if _, err := TOTPCode(secret, 1); err != nil {
+		t.Errorf("TOTPCode() rejected generated secret %q: %v", secret, err)
+	}
+
+	uri, err := url.Parse(TOTPURI(secret, "Chirpy", "walt@example.com"))
+	if err != nil {
+		t.Fatalf("TOTPURI() is not a valid URL: %v", err)
+	}
+	if uri.Scheme != "otpauth" || uri.Host != "totp" || uri.Path != "/Chirpy:walt@example.com" {
+		t.Errorf("TOTPURI() = %v", uri)
+	}
+	if uri.Query().Get("secret") != secret || uri.Query().Get("issuer") != "Chirpy" {
+		t.Errorf("TOTPURI() query = %v", uri.Query())
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(RecoveryCodeCount)
+	if err != nil {
+		t.Fatalf("GenerateRecoveryCodes() error = %v", err)
+	}
+	if len(codes) != RecoveryCodeCount {
+		t.Fatalf("GenerateRecoveryCodes() returned %d codes, want %d", len(codes), RecoveryCodeCount)
+	}
+
+	seen := map[string]bool{}
+	for _, code := range codes {
+		if len(code) != 11 || code[5] != '-' {
+			t.Errorf("recovery code %q is not of the form xxxxx-xxxxx", code)
+		}
+		if seen[code] {
+			t.Errorf("recovery code %q generated twice", code)
+		}
+		seen[code] = true
+	}
+
+	loose := strings.ToUpper(strings.ReplaceAll(codes[0], "-", " "))
+	if HashRecoveryCode(loose) != HashRecoveryCode(codes[0]) {
+		t.Errorf("HashRecoveryCode() depends on case or separators")
+	}
+	if HashRecoveryCode(codes[0]) == HashRecoveryCode(codes[1]) {
+		t.Errorf("HashRecoveryCode() returned the same hash for different codes")
+	}
+}
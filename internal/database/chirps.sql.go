@@ -7,29 +7,89 @@ package database
 
 import (
 	"context"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 const createChirp = `-- name: CreateChirp :one
-INSERT INTO chirps (id, created_at, updated_at, body, user_id)
-VALUES (    
-    gen_random_uuid(),
-  NOW(),
-  NOW(),
-  $1,
-  $2
+WITH new_chirp AS (
+    SELECT gen_random_uuid() AS id
 )
-RETURNING id, created_at, updated_at, body, user_id
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, in_reply_to, conversation_id, quoted_chirp_id)
+SELECT
+    new_chirp.id,
+    NOW(),
+    NOW(),
+    $1::text,
+    $2::uuid,
+    $3::uuid,
+    COALESCE($4::uuid, new_chirp.id),
+    $5::uuid
+FROM new_chirp
+RETURNING id, created_at, updated_at, body, user_id, search_vector, in_reply_to, conversation_id, deleted_at, like_count, quoted_chirp_id, rechirp_of
 `
 
 type CreateChirpParams struct {
-	Body   string
-	UserID uuid.UUID
+	Body           string
+	UserID         uuid.UUID
+	InReplyTo      uuid.NullUUID
+	ConversationID uuid.NullUUID
+	QuotedChirpID  uuid.NullUUID
 }
 
 func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp, error) {
-	row := q.db.QueryRowContext(ctx, createChirp, arg.Body, arg.UserID)
+	row := q.db.QueryRowContext(ctx, createChirp,
+		arg.Body,
+		arg.UserID,
+		arg.InReplyTo,
+		arg.ConversationID,
+		arg.QuotedChirpID,
+	)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.SearchVector,
+		&i.InReplyTo,
+		&i.ConversationID,
+		&i.DeletedAt,
+		&i.LikeCount,
+		&i.QuotedChirpID,
+		&i.RechirpOf,
+	)
+	return i, err
+}
+
+const createRechirp = `-- name: CreateRechirp :one
+WITH new_chirp AS (
+    SELECT gen_random_uuid() AS id
+)
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, conversation_id, rechirp_of)
+SELECT
+    new_chirp.id,
+    NOW(),
+    NOW(),
+    '',
+    $1::uuid,
+    new_chirp.id,
+    $2::uuid
+FROM new_chirp
+ON CONFLICT DO NOTHING
+RETURNING id, created_at, updated_at, body, user_id, search_vector, in_reply_to, conversation_id, deleted_at, like_count, quoted_chirp_id, rechirp_of
+`
+
+type CreateRechirpParams struct {
+	UserID    uuid.UUID
+	RechirpOf uuid.UUID
+}
+
+func (q *Queries) CreateRechirp(ctx context.Context, arg CreateRechirpParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, createRechirp, arg.UserID, arg.RechirpOf)
 	var i Chirp
 	err := row.Scan(
 		&i.ID,
@@ -37,12 +97,22 @@ func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.SearchVector,
+		&i.InReplyTo,
+		&i.ConversationID,
+		&i.DeletedAt,
+		&i.LikeCount,
+		&i.QuotedChirpID,
+		&i.RechirpOf,
 	)
 	return i, err
 }
 
 const deleteChirp = `-- name: DeleteChirp :exec
-DELETE FROM chirps
+UPDATE chirps
+SET body = '',
+    deleted_at = NOW(),
+    updated_at = NOW()
 WHERE id = $1
 `
 
@@ -51,8 +121,37 @@ func (q *Queries) DeleteChirp(ctx context.Context, id uuid.UUID) error {
 	return err
 }
 
+const deleteRechirp = `-- name: DeleteRechirp :execrows
+DELETE FROM chirps
+WHERE user_id = $1
+    AND rechirp_of = $2
+`
+
+type DeleteRechirpParams struct {
+	UserID    uuid.UUID
+	RechirpOf uuid.NullUUID
+}
+
+func (q *Queries) DeleteRechirp(ctx context.Context, arg DeleteRechirpParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteRechirp, arg.UserID, arg.RechirpOf)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const deleteRechirpsOf = `-- name: DeleteRechirpsOf :exec
+DELETE FROM chirps
+WHERE rechirp_of = $1
+`
+
+func (q *Queries) DeleteRechirpsOf(ctx context.Context, rechirpOf uuid.NullUUID) error {
+	_, err := q.db.ExecContext(ctx, deleteRechirpsOf, rechirpOf)
+	return err
+}
+
 const getChirp = `-- name: GetChirp :one
-SELECT id, created_at, updated_at, body, user_id FROM chirps
+SELECT id, created_at, updated_at, body, user_id, search_vector, in_reply_to, conversation_id, deleted_at, like_count, quoted_chirp_id, rechirp_of FROM chirps
 WHERE id = $1
 `
 
@@ -65,18 +164,365 @@ func (q *Queries) GetChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.SearchVector,
+		&i.InReplyTo,
+		&i.ConversationID,
+		&i.DeletedAt,
+		&i.LikeCount,
+		&i.QuotedChirpID,
+		&i.RechirpOf,
+	)
+	return i, err
+}
+
+const getChirpForUpdate = `-- name: GetChirpForUpdate :one
+SELECT id, created_at, updated_at, body, user_id, search_vector, in_reply_to, conversation_id, deleted_at, like_count, quoted_chirp_id, rechirp_of FROM chirps
+WHERE id = $1
+FOR UPDATE
+`
+
+func (q *Queries) GetChirpForUpdate(ctx context.Context, id uuid.UUID) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, getChirpForUpdate, id)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.SearchVector,
+		&i.InReplyTo,
+		&i.ConversationID,
+		&i.DeletedAt,
+		&i.LikeCount,
+		&i.QuotedChirpID,
+		&i.RechirpOf,
 	)
 	return i, err
 }
 
-const getChirps = `-- name: GetChirps :many
-SELECT id, created_at, updated_at, body, user_id
+const getChirpsByIDs = `-- name: GetChirpsByIDs :many
+SELECT id, created_at, updated_at, body, user_id, search_vector, in_reply_to, conversation_id, deleted_at, like_count, quoted_chirp_id, rechirp_of FROM chirps
+WHERE id = ANY($1::uuid[])
+`
+
+func (q *Queries) GetChirpsByIDs(ctx context.Context, ids []uuid.UUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpsByIDs, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.SearchVector,
+			&i.InReplyTo,
+			&i.ConversationID,
+			&i.DeletedAt,
+			&i.LikeCount,
+			&i.QuotedChirpID,
+			&i.RechirpOf,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listChirpsAsc = `-- name: ListChirpsAsc :many
+SELECT id, created_at, updated_at, body, user_id, search_vector, in_reply_to, conversation_id, deleted_at, like_count, quoted_chirp_id, rechirp_of FROM chirps
+WHERE deleted_at IS NULL
+    AND (created_at, id) > ($1::timestamptz, $2::uuid)
+ORDER BY created_at ASC, id ASC
+LIMIT $3
+`
+
+type ListChirpsAscParams struct {
+	CursorCreatedAt time.Time
+	CursorID        uuid.UUID
+	Limit           int32
+}
+
+func (q *Queries) ListChirpsAsc(ctx context.Context, arg ListChirpsAscParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpsAsc, arg.CursorCreatedAt, arg.CursorID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.SearchVector,
+			&i.InReplyTo,
+			&i.ConversationID,
+			&i.DeletedAt,
+			&i.LikeCount,
+			&i.QuotedChirpID,
+			&i.RechirpOf,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listChirpsByAuthorAsc = `-- name: ListChirpsByAuthorAsc :many
+SELECT id, created_at, updated_at, body, user_id, search_vector, in_reply_to, conversation_id, deleted_at, like_count, quoted_chirp_id, rechirp_of FROM chirps
+WHERE user_id = $1
+    AND deleted_at IS NULL
+    AND (created_at, id) > ($2::timestamptz, $3::uuid)
+ORDER BY created_at ASC, id ASC
+LIMIT $4
+`
+
+type ListChirpsByAuthorAscParams struct {
+	UserID          uuid.UUID
+	CursorCreatedAt time.Time
+	CursorID        uuid.UUID
+	Limit           int32
+}
+
+func (q *Queries) ListChirpsByAuthorAsc(ctx context.Context, arg ListChirpsByAuthorAscParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpsByAuthorAsc,
+		arg.UserID,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.SearchVector,
+			&i.InReplyTo,
+			&i.ConversationID,
+			&i.DeletedAt,
+			&i.LikeCount,
+			&i.QuotedChirpID,
+			&i.RechirpOf,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listChirpsByAuthorDesc = `-- name: ListChirpsByAuthorDesc :many
+SELECT id, created_at, updated_at, body, user_id, search_vector, in_reply_to, conversation_id, deleted_at, like_count, quoted_chirp_id, rechirp_of FROM chirps
+WHERE user_id = $1
+    AND deleted_at IS NULL
+    AND (created_at, id) < ($2::timestamptz, $3::uuid)
+ORDER BY created_at DESC, id DESC
+LIMIT $4
+`
+
+type ListChirpsByAuthorDescParams struct {
+	UserID          uuid.UUID
+	CursorCreatedAt time.Time
+	CursorID        uuid.UUID
+	Limit           int32
+}
+
+func (q *Queries) ListChirpsByAuthorDesc(ctx context.Context, arg ListChirpsByAuthorDescParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpsByAuthorDesc,
+		arg.UserID,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.SearchVector,
+			&i.InReplyTo,
+			&i.ConversationID,
+			&i.DeletedAt,
+			&i.LikeCount,
+			&i.QuotedChirpID,
+			&i.RechirpOf,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listChirpsDesc = `-- name: ListChirpsDesc :many
+SELECT id, created_at, updated_at, body, user_id, search_vector, in_reply_to, conversation_id, deleted_at, like_count, quoted_chirp_id, rechirp_of FROM chirps
+WHERE deleted_at IS NULL
+    AND (created_at, id) < ($1::timestamptz, $2::uuid)
+ORDER BY created_at DESC, id DESC
+LIMIT $3
+`
+
+type ListChirpsDescParams struct {
+	CursorCreatedAt time.Time
+	CursorID        uuid.UUID
+	Limit           int32
+}
+
+func (q *Queries) ListChirpsDesc(ctx context.Context, arg ListChirpsDescParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpsDesc, arg.CursorCreatedAt, arg.CursorID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.SearchVector,
+			&i.InReplyTo,
+			&i.ConversationID,
+			&i.DeletedAt,
+			&i.LikeCount,
+			&i.QuotedChirpID,
+			&i.RechirpOf,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listConversationChirps = `-- name: ListConversationChirps :many
+SELECT id, created_at, updated_at, body, user_id, search_vector, in_reply_to, conversation_id, deleted_at, like_count, quoted_chirp_id, rechirp_of FROM chirps
+WHERE conversation_id = $1
+ORDER BY created_at ASC, id ASC
+`
+
+func (q *Queries) ListConversationChirps(ctx context.Context, conversationID uuid.UUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listConversationChirps, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.SearchVector,
+			&i.InReplyTo,
+			&i.ConversationID,
+			&i.DeletedAt,
+			&i.LikeCount,
+			&i.QuotedChirpID,
+			&i.RechirpOf,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listTimelineChirps = `-- name: ListTimelineChirps :many
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.search_vector, chirps.in_reply_to, chirps.conversation_id, chirps.deleted_at, chirps.like_count, chirps.quoted_chirp_id, chirps.rechirp_of
 FROM chirps
-ORDER BY created_at ASC
+JOIN follows ON follows.followee_id = chirps.user_id
+WHERE follows.follower_id = $1
+    AND chirps.deleted_at IS NULL
+    AND (chirps.created_at, chirps.id) < ($2::timestamptz, $3::uuid)
+ORDER BY chirps.created_at DESC, chirps.id DESC
+LIMIT $4
 `
 
-func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
-	rows, err := q.db.QueryContext(ctx, getChirps)
+type ListTimelineChirpsParams struct {
+	FollowerID      uuid.UUID
+	CursorCreatedAt time.Time
+	CursorID        uuid.UUID
+	Limit           int32
+}
+
+func (q *Queries) ListTimelineChirps(ctx context.Context, arg ListTimelineChirpsParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listTimelineChirps,
+		arg.FollowerID,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.Limit,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -90,6 +536,13 @@ func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.SearchVector,
+			&i.InReplyTo,
+			&i.ConversationID,
+			&i.DeletedAt,
+			&i.LikeCount,
+			&i.QuotedChirpID,
+			&i.RechirpOf,
 		); err != nil {
 			return nil, err
 		}
@@ -103,3 +556,36 @@ func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
 	}
 	return items, nil
 }
+
+const updateChirpBody = `-- name: UpdateChirpBody :one
+UPDATE chirps
+SET body = $2,
+    updated_at = NOW()
+WHERE id = $1
+RETURNING id, created_at, updated_at, body, user_id, search_vector, in_reply_to, conversation_id, deleted_at, like_count, quoted_chirp_id, rechirp_of
+`
+
+type UpdateChirpBodyParams struct {
+	ID   uuid.UUID
+	Body string
+}
+
+func (q *Queries) UpdateChirpBody(ctx context.Context, arg UpdateChirpBodyParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, updateChirpBody, arg.ID, arg.Body)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.SearchVector,
+		&i.InReplyTo,
+		&i.ConversationID,
+		&i.DeletedAt,
+		&i.LikeCount,
+		&i.QuotedChirpID,
+		&i.RechirpOf,
+	)
+	return i, err
+}
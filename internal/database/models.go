@@ -12,27 +12,195 @@ import (
 )
 
 type Chirp struct {
+	ID             uuid.UUID
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	Body           string
+	UserID         uuid.UUID
+	SearchVector   interface{}
+	InReplyTo      uuid.NullUUID
+	ConversationID uuid.UUID
+	DeletedAt      sql.NullTime
+	LikeCount      int32
+	QuotedChirpID  uuid.NullUUID
+	RechirpOf      uuid.NullUUID
+}
+
+type ChirpEntity struct {
+	ID         uuid.UUID
+	ChirpID    uuid.UUID
+	Kind       string
+	Text       string
+	Normalized string
+	UserID     uuid.NullUUID
+	ByteStart  int32
+	ByteEnd    int32
+	CharStart  int32
+	CharEnd    int32
+}
+
+type ChirpRevision struct {
 	ID        uuid.UUID
-	CreatedAt time.Time
-	UpdatedAt time.Time
+	ChirpID   uuid.UUID
 	Body      string
+	CreatedAt time.Time
+}
+
+type EmailChangeToken struct {
+	TokenHash string
 	UserID    uuid.UUID
+	NewEmail  string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    sql.NullTime
 }
 
-type RefreshToken struct {
-	Token     string
+type EmailVerificationToken struct {
+	TokenHash string
+	UserID    uuid.UUID
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    sql.NullTime
+}
+
+type ExternalIdentity struct {
+	ID          uuid.UUID
+	UserID      uuid.UUID
+	Issuer      string
+	Subject     string
+	Email       string
+	CreatedAt   time.Time
+	LastLoginAt time.Time
+}
+
+type Follow struct {
+	FollowerID uuid.UUID
+	FolloweeID uuid.UUID
+	CreatedAt  time.Time
+}
+
+type Like struct {
+	UserID    uuid.UUID
+	ChirpID   uuid.UUID
+	CreatedAt time.Time
+}
+
+type LoginThrottle struct {
+	Scope         string
+	Key           string
+	Failures      int32
+	LastFailureAt time.Time
+	LockedUntil   time.Time
+}
+
+type OauthAuthorizationCode struct {
+	CodeHash      string
+	ClientID      uuid.UUID
+	UserID        uuid.UUID
+	RedirectURI   string
+	Scopes        []string
+	Nonce         string
+	CodeChallenge string
+	CreatedAt     time.Time
+	ExpiresAt     time.Time
+	UsedAt        sql.NullTime
+}
+
+type OauthClient struct {
+	ID           uuid.UUID
+	OwnerID      uuid.UUID
+	Name         string
+	SecretHash   sql.NullString
+	RedirectURIs []string
+	Scopes       []string
+	CreatedAt    time.Time
+}
+
+type OauthConsent struct {
 	UserID    uuid.UUID
+	ClientID  uuid.UUID
+	Scopes    []string
 	CreatedAt time.Time
 	UpdatedAt time.Time
+}
+
+type OidcLoginState struct {
+	StateHash    string
+	BrowserHash  string
+	Nonce        string
+	CodeVerifier string
+	CreatedAt    time.Time
+	ExpiresAt    time.Time
+}
+
+type PasswordResetToken struct {
+	TokenHash string
+	UserID    uuid.UUID
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    sql.NullTime
+}
+
+type PersonalAccessToken struct {
+	ID         uuid.UUID
+	UserID     uuid.UUID
+	Name       string
+	TokenHash  string
+	Scopes     []string
+	CreatedAt  time.Time
+	LastUsedAt sql.NullTime
+	ExpiresAt  sql.NullTime
+	RevokedAt  sql.NullTime
+}
+
+type RecoveryCode struct {
+	UserID    uuid.UUID
+	CodeHash  string
+	CreatedAt time.Time
+	UsedAt    sql.NullTime
+}
+
+type RefreshToken struct {
+	TokenHash  string
+	UserID     uuid.UUID
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	ExpiresAt  time.Time
+	RevokedAt  sql.NullTime
+	SessionID  uuid.UUID
+	RotatedAt  sql.NullTime
+	Hashed     bool
+	UserAgent  string
+	IP         string
+	LastUsedAt time.Time
+}
+
+type RevokedAccessToken struct {
+	Jti       string
+	UserID    uuid.UUID
+	RevokedAt time.Time
 	ExpiresAt time.Time
-	RevokedAt sql.NullTime
 }
 
 type User struct {
-	ID             uuid.UUID
-	CreatedAt      time.Time
-	UpdatedAt      time.Time
-	Email          string
-	HashedPassword string
-	IsChirpyRed    bool
+	ID                      uuid.UUID
+	CreatedAt               time.Time
+	UpdatedAt               time.Time
+	Email                   string
+	HashedPassword          string
+	IsChirpyRed             bool
+	Username                sql.NullString
+	DisplayName             string
+	Bio                     string
+	AvatarURL               string
+	EmailVerifiedAt         sql.NullTime
+	GrandfatheredUnverified bool
+}
+
+type UserTotp struct {
+	UserID       uuid.UUID
+	Secret       string
+	CreatedAt    time.Time
+	ConfirmedAt  sql.NullTime
+	LastUsedStep int64
 }
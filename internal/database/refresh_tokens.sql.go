@@ -13,56 +13,99 @@ import (
 )
 
 const createRefreshToken = `-- name: CreateRefreshToken :one
-INSERT INTO refresh_tokens (token, user_id, created_at, updated_at, expires_at)
+INSERT INTO refresh_tokens (token_hash, user_id, created_at, updated_at, expires_at, session_id, user_agent, ip, last_used_at)
 VALUES (
     $1,
     $2,
     $3,
     $4,
-    $5
+    $5,
+    $6,
+    $7,
+    $8,
+    $3
 )
-RETURNING token, user_id, created_at, updated_at, expires_at, revoked_at
+RETURNING token_hash, user_id, created_at, updated_at, expires_at, revoked_at, session_id, rotated_at, hashed, user_agent, ip, last_used_at
 `
 
 type CreateRefreshTokenParams struct {
-	Token     string
+	TokenHash string
 	UserID    uuid.UUID
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	ExpiresAt time.Time
+	SessionID uuid.UUID
+	UserAgent string
+	IP        string
 }
 
 func (q *Queries) CreateRefreshToken(ctx context.Context, arg CreateRefreshTokenParams) (RefreshToken, error) {
 	row := q.db.QueryRowContext(ctx, createRefreshToken,
-		arg.Token,
+		arg.TokenHash,
 		arg.UserID,
 		arg.CreatedAt,
 		arg.UpdatedAt,
 		arg.ExpiresAt,
+		arg.SessionID,
+		arg.UserAgent,
+		arg.IP,
 	)
 	var i RefreshToken
 	err := row.Scan(
-		&i.Token,
+		&i.TokenHash,
 		&i.UserID,
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.ExpiresAt,
 		&i.RevokedAt,
+		&i.SessionID,
+		&i.RotatedAt,
+		&i.Hashed,
+		&i.UserAgent,
+		&i.IP,
+		&i.LastUsedAt,
+	)
+	return i, err
+}
+
+const getRefreshTokenForUpdate = `-- name: GetRefreshTokenForUpdate :one
+SELECT token_hash, user_id, created_at, updated_at, expires_at, revoked_at, session_id, rotated_at, hashed, user_agent, ip, last_used_at
+FROM refresh_tokens
+WHERE token_hash = $1
+FOR UPDATE
+`
+
+func (q *Queries) GetRefreshTokenForUpdate(ctx context.Context, tokenHash string) (RefreshToken, error) {
+	row := q.db.QueryRowContext(ctx, getRefreshTokenForUpdate, tokenHash)
+	var i RefreshToken
+	err := row.Scan(
+		&i.TokenHash,
+		&i.UserID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.ExpiresAt,
+		&i.RevokedAt,
+		&i.SessionID,
+		&i.RotatedAt,
+		&i.Hashed,
+		&i.UserAgent,
+		&i.IP,
+		&i.LastUsedAt,
 	)
 	return i, err
 }
 
 const getuserByRefreshToken = `-- name: GetuserByRefreshToken :one
-SELECT users.id, users.created_at, users.updated_at, users.email, users.hashed_password, users.is_chirpy_red
+SELECT users.id, users.created_at, users.updated_at, users.email, users.hashed_password, users.is_chirpy_red, users.username, users.display_name, users.bio, users.avatar_url, users.email_verified_at, users.grandfathered_unverified
 FROM users
 JOIN refresh_tokens ON users.id = refresh_tokens.user_id
-WHERE refresh_tokens.token = $1
+WHERE refresh_tokens.token_hash = $1
     AND revoked_at IS NULL
     AND expires_at > NOW()
 `
 
-func (q *Queries) GetuserByRefreshToken(ctx context.Context, token string) (User, error) {
-	row := q.db.QueryRowContext(ctx, getuserByRefreshToken, token)
+func (q *Queries) GetuserByRefreshToken(ctx context.Context, tokenHash string) (User, error) {
+	row := q.db.QueryRowContext(ctx, getuserByRefreshToken, tokenHash)
 	var i User
 	err := row.Scan(
 		&i.ID,
@@ -71,28 +114,217 @@ func (q *Queries) GetuserByRefreshToken(ctx context.Context, token string) (User
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.Username,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarURL,
+		&i.EmailVerifiedAt,
+		&i.GrandfatheredUnverified,
 	)
 	return i, err
 }
 
+const hashRefreshToken = `-- name: HashRefreshToken :exec
+UPDATE refresh_tokens
+SET token_hash = $1,
+    hashed = TRUE
+WHERE token_hash = $2
+    AND NOT hashed
+`
+
+type HashRefreshTokenParams struct {
+	TokenHash string
+	Token     string
+}
+
+func (q *Queries) HashRefreshToken(ctx context.Context, arg HashRefreshTokenParams) error {
+	_, err := q.db.ExecContext(ctx, hashRefreshToken, arg.TokenHash, arg.Token)
+	return err
+}
+
+const listActiveSessions = `-- name: ListActiveSessions :many
+SELECT
+    rt.session_id,
+    (
+        SELECT MIN(s.created_at)
+        FROM refresh_tokens s
+        WHERE s.session_id = rt.session_id
+    )::timestamp AS created_at,
+    rt.last_used_at,
+    rt.expires_at,
+    rt.user_agent,
+    rt.ip
+FROM refresh_tokens rt
+WHERE rt.user_id = $1
+    AND rt.revoked_at IS NULL
+    AND rt.expires_at > NOW()
+ORDER BY rt.last_used_at DESC
+`
+
+type ListActiveSessionsRow struct {
+	SessionID  uuid.UUID
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+	ExpiresAt  time.Time
+	UserAgent  string
+	IP         string
+}
+
+func (q *Queries) ListActiveSessions(ctx context.Context, userID uuid.UUID) ([]ListActiveSessionsRow, error) {
+	rows, err := q.db.QueryContext(ctx, listActiveSessions, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListActiveSessionsRow
+	for rows.Next() {
+		var i ListActiveSessionsRow
+		if err := rows.Scan(
+			&i.SessionID,
+			&i.CreatedAt,
+			&i.LastUsedAt,
+			&i.ExpiresAt,
+			&i.UserAgent,
+			&i.IP,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUnhashedRefreshTokens = `-- name: ListUnhashedRefreshTokens :many
+SELECT token_hash
+FROM refresh_tokens
+WHERE NOT hashed
+`
+
+func (q *Queries) ListUnhashedRefreshTokens(ctx context.Context) ([]string, error) {
+	rows, err := q.db.QueryContext(ctx, listUnhashedRefreshTokens)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []string
+	for rows.Next() {
+		var token_hash string
+		if err := rows.Scan(&token_hash); err != nil {
+			return nil, err
+		}
+		items = append(items, token_hash)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const revokeRefreshToken = `-- name: RevokeRefreshToken :one
 UPDATE refresh_tokens
 SET revoked_at = NOW(),
     updated_at = NOW()
-WHERE token = $1
-RETURNING token, user_id, created_at, updated_at, expires_at, revoked_at
+WHERE token_hash = $1
+RETURNING token_hash, user_id, created_at, updated_at, expires_at, revoked_at, session_id, rotated_at, hashed, user_agent, ip, last_used_at
 `
 
-func (q *Queries) RevokeRefreshToken(ctx context.Context, token string) (RefreshToken, error) {
-	row := q.db.QueryRowContext(ctx, revokeRefreshToken, token)
+func (q *Queries) RevokeRefreshToken(ctx context.Context, tokenHash string) (RefreshToken, error) {
+	row := q.db.QueryRowContext(ctx, revokeRefreshToken, tokenHash)
 	var i RefreshToken
 	err := row.Scan(
-		&i.Token,
+		&i.TokenHash,
 		&i.UserID,
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.ExpiresAt,
 		&i.RevokedAt,
+		&i.SessionID,
+		&i.RotatedAt,
+		&i.Hashed,
+		&i.UserAgent,
+		&i.IP,
+		&i.LastUsedAt,
 	)
 	return i, err
 }
+
+const revokeSession = `-- name: RevokeSession :execrows
+UPDATE refresh_tokens
+SET revoked_at = NOW(),
+    updated_at = NOW()
+WHERE session_id = $1
+    AND user_id = $2
+    AND revoked_at IS NULL
+`
+
+type RevokeSessionParams struct {
+	SessionID uuid.UUID
+	UserID    uuid.UUID
+}
+
+func (q *Queries) RevokeSession(ctx context.Context, arg RevokeSessionParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, revokeSession, arg.SessionID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const revokeUserRefreshTokens = `-- name: RevokeUserRefreshTokens :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW(),
+    updated_at = NOW()
+WHERE user_id = $1
+    AND revoked_at IS NULL
+`
+
+func (q *Queries) RevokeUserRefreshTokens(ctx context.Context, userID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, revokeUserRefreshTokens, userID)
+	return err
+}
+
+const rotateRefreshToken = `-- name: RotateRefreshToken :execrows
+UPDATE refresh_tokens
+SET rotated_at = NOW(),
+    revoked_at = NOW(),
+    updated_at = NOW()
+WHERE token_hash = $1
+    AND rotated_at IS NULL
+    AND revoked_at IS NULL
+`
+
+func (q *Queries) RotateRefreshToken(ctx context.Context, tokenHash string) (int64, error) {
+	result, err := q.db.ExecContext(ctx, rotateRefreshToken, tokenHash)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const touchSession = `-- name: TouchSession :exec
+UPDATE refresh_tokens
+SET last_used_at = $1
+WHERE session_id = $2
+    AND revoked_at IS NULL
+    AND last_used_at < $3
+`
+
+type TouchSessionParams struct {
+	Now           time.Time
+	SessionID     uuid.UUID
+	TouchedBefore time.Time
+}
+
+func (q *Queries) TouchSession(ctx context.Context, arg TouchSessionParams) error {
+	_, err := q.db.ExecContext(ctx, touchSession, arg.Now, arg.SessionID, arg.TouchedBefore)
+	return err
+}
@@ -7,10 +7,57 @@ package database
 
 import (
 	"context"
+	"database/sql"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
+const countUsersByPasswordParams = `-- name: CountUsersByPasswordParams :many
+SELECT
+    split_part(hashed_password, '$', 4)::TEXT AS params,
+    length(split_part(hashed_password, '$', 5))::INT AS salt_chars,
+    length(split_part(hashed_password, '$', 6))::INT AS key_chars,
+    COUNT(*) AS users
+FROM users
+GROUP BY 1, 2, 3
+`
+
+type CountUsersByPasswordParamsRow struct {
+	Params    string
+	SaltChars int32
+	KeyChars  int32
+	Users     int64
+}
+
+func (q *Queries) CountUsersByPasswordParams(ctx context.Context) ([]CountUsersByPasswordParamsRow, error) {
+	rows, err := q.db.QueryContext(ctx, countUsersByPasswordParams)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []CountUsersByPasswordParamsRow
+	for rows.Next() {
+		var i CountUsersByPasswordParamsRow
+		if err := rows.Scan(
+			&i.Params,
+			&i.SaltChars,
+			&i.KeyChars,
+			&i.Users,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const createUser = `-- name: CreateUser :one
 INSERT INTO users (id, created_at, updated_at, email, hashed_password)
 VALUES (
@@ -21,7 +68,7 @@ VALUES (
   $2
 
 )
-RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, username, display_name, bio, avatar_url, email_verified_at, grandfathered_unverified
 `
 
 type CreateUserParams struct {
@@ -39,12 +86,18 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.Username,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarURL,
+		&i.EmailVerifiedAt,
+		&i.GrandfatheredUnverified,
 	)
 	return i, err
 }
 
 const getUserByEmail = `-- name: GetUserByEmail :one
-SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, username, display_name, bio, avatar_url, email_verified_at, grandfathered_unverified
 FROM users
 WHERE email = $1
 `
@@ -59,28 +112,252 @@ func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.Username,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarURL,
+		&i.EmailVerifiedAt,
+		&i.GrandfatheredUnverified,
+	)
+	return i, err
+}
+
+const getUserByID = `-- name: GetUserByID :one
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, username, display_name, bio, avatar_url, email_verified_at, grandfathered_unverified
+FROM users
+WHERE id = $1
+`
+
+func (q *Queries) GetUserByID(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByID, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Username,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarURL,
+		&i.EmailVerifiedAt,
+		&i.GrandfatheredUnverified,
+	)
+	return i, err
+}
+
+const getUserByUsername = `-- name: GetUserByUsername :one
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, username, display_name, bio, avatar_url, email_verified_at, grandfathered_unverified
+FROM users
+WHERE LOWER(username) = LOWER($1)
+`
+
+func (q *Queries) GetUserByUsername(ctx context.Context, username string) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByUsername, username)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Username,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarURL,
+		&i.EmailVerifiedAt,
+		&i.GrandfatheredUnverified,
 	)
 	return i, err
 }
 
-const updateUser = `-- name: UpdateUser :one
+const getUsersByUsernames = `-- name: GetUsersByUsernames :many
+SELECT id, LOWER(username) AS username
+FROM users
+WHERE LOWER(username) = ANY($1::text[])
+`
+
+type GetUsersByUsernamesRow struct {
+	ID       uuid.UUID
+	Username string
+}
+
+func (q *Queries) GetUsersByUsernames(ctx context.Context, usernames []string) ([]GetUsersByUsernamesRow, error) {
+	rows, err := q.db.QueryContext(ctx, getUsersByUsernames, pq.Array(usernames))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetUsersByUsernamesRow
+	for rows.Next() {
+		var i GetUsersByUsernamesRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Username,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const markUserEmailVerified = `-- name: MarkUserEmailVerified :one
+UPDATE users
+SET
+    email_verified_at = COALESCE(email_verified_at, NOW()),
+    updated_at = NOW()
+WHERE id = $1
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, username, display_name, bio, avatar_url, email_verified_at, grandfathered_unverified
+`
+
+func (q *Queries) MarkUserEmailVerified(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, markUserEmailVerified, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Username,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarURL,
+		&i.EmailVerifiedAt,
+		&i.GrandfatheredUnverified,
+	)
+	return i, err
+}
+
+const rehashUserPassword = `-- name: RehashUserPassword :execrows
+UPDATE users
+SET hashed_password = $1
+WHERE id = $2
+    AND hashed_password = $3
+`
+
+type RehashUserPasswordParams struct {
+	NewHash string
+	ID      uuid.UUID
+	OldHash string
+}
+
+func (q *Queries) RehashUserPassword(ctx context.Context, arg RehashUserPasswordParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, rehashUserPassword, arg.NewHash, arg.ID, arg.OldHash)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const updateUserEmail = `-- name: UpdateUserEmail :one
 UPDATE users
 SET
     email = $2,
-    hashed_password = $3,
+    email_verified_at = NOW(),
     updated_at = NOW()
 WHERE id = $1
-RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, username, display_name, bio, avatar_url, email_verified_at, grandfathered_unverified
 `
 
-type UpdateUserParams struct {
+type UpdateUserEmailParams struct {
+	ID    uuid.UUID
+	Email string
+}
+
+func (q *Queries) UpdateUserEmail(ctx context.Context, arg UpdateUserEmailParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, updateUserEmail, arg.ID, arg.Email)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Username,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarURL,
+		&i.EmailVerifiedAt,
+		&i.GrandfatheredUnverified,
+	)
+	return i, err
+}
+
+const updateUserPassword = `-- name: UpdateUserPassword :one
+UPDATE users
+SET
+    hashed_password = $2,
+    updated_at = NOW()
+WHERE id = $1
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, username, display_name, bio, avatar_url, email_verified_at, grandfathered_unverified
+`
+
+type UpdateUserPasswordParams struct {
 	ID             uuid.UUID
-	Email          string
 	HashedPassword string
 }
 
-func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, error) {
-	row := q.db.QueryRowContext(ctx, updateUser, arg.ID, arg.Email, arg.HashedPassword)
+func (q *Queries) UpdateUserPassword(ctx context.Context, arg UpdateUserPasswordParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, updateUserPassword, arg.ID, arg.HashedPassword)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Username,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarURL,
+		&i.EmailVerifiedAt,
+		&i.GrandfatheredUnverified,
+	)
+	return i, err
+}
+
+const updateUserProfile = `-- name: UpdateUserProfile :one
+UPDATE users
+SET
+    username = COALESCE($1, username),
+    display_name = COALESCE($2, display_name),
+    bio = COALESCE($3, bio),
+    avatar_url = COALESCE($4, avatar_url),
+    updated_at = NOW()
+WHERE id = $5
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, username, display_name, bio, avatar_url, email_verified_at, grandfathered_unverified
+`
+
+type UpdateUserProfileParams struct {
+	Username    sql.NullString
+	DisplayName sql.NullString
+	Bio         sql.NullString
+	AvatarURL   sql.NullString
+	ID          uuid.UUID
+}
+
+func (q *Queries) UpdateUserProfile(ctx context.Context, arg UpdateUserProfileParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, updateUserProfile,
+		arg.Username,
+		arg.DisplayName,
+		arg.Bio,
+		arg.AvatarURL,
+		arg.ID,
+	)
 	var i User
 	err := row.Scan(
 		&i.ID,
@@ -89,6 +366,12 @@ func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, e
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.Username,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarURL,
+		&i.EmailVerifiedAt,
+		&i.GrandfatheredUnverified,
 	)
 	return i, err
 }
@@ -99,7 +382,7 @@ SET
     is_chirpy_red = TRUE,
     updated_at = NOW()
 WHERE id = $1
-RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, username, display_name, bio, avatar_url, email_verified_at, grandfathered_unverified
 `
 
 func (q *Queries) UpgradeToChirpyRed(ctx context.Context, id uuid.UUID) (User, error) {
@@ -112,6 +395,12 @@ func (q *Queries) UpgradeToChirpyRed(ctx context.Context, id uuid.UUID) (User, e
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.Username,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarURL,
+		&i.EmailVerifiedAt,
+		&i.GrandfatheredUnverified,
 	)
 	return i, err
 }
@@ -0,0 +1,103 @@
+package entities
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+type Kind string
+
+const (
+	KindHashtag Kind = "hashtag"
+	KindMention Kind = "mention"
+	KindURL     Kind = "url"
+)
+
+// Entity is a hashtag, mention or URL found in a chirp body. Offsets are
+// half-open ranges into the body, in bytes and in characters (runes).
+type Entity struct {
+	Kind       Kind
+	Text       string
+	Normalized string
+	ByteStart  int
+	ByteEnd    int
+	CharStart  int
+	CharEnd    int
+}
+
+var (
+	urlPattern     = regexp.MustCompile(`https?://[^\s]+`)
+	hashtagPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_&])(#[\p{L}\p{N}_]*\p{L}[\p{L}\p{N}_]*)`)
+	mentionPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_@.])(@[A-Za-z0-9_]{1,30})\b`)
+)
+
+const urlTrailingPunctuation = ".,:;!?'\")]}"
+
+// Parse extracts entities from body in the order they appear. Hashtags and
+// mentions inside URLs are ignored.
+func Parse(body string) []Entity {
+	var found []Entity
+
+	for _, loc := range urlPattern.FindAllStringIndex(body, -1) {
+		start, end := loc[0], loc[1]
+		for end > start && strings.ContainsRune(urlTrailingPunctuation, rune(body[end-1])) {
+			end--
+		}
+		text := body[start:end]
+		if text == "http://" || text == "https://" {
+			continue
+		}
+		found = append(found, newEntity(body, KindURL, start, end, text))
+	}
+
+	urls := found
+	for _, loc := range hashtagPattern.FindAllStringSubmatchIndex(body, -1) {
+		start, end := loc[2], loc[3]
+		if overlaps(urls, start, end) {
+			continue
+		}
+		found = append(found, newEntity(body, KindHashtag, start, end, strings.ToLower(body[start+1:end])))
+	}
+	for _, loc := range mentionPattern.FindAllStringSubmatchIndex(body, -1) {
+		start, end := loc[2], loc[3]
+		if overlaps(urls, start, end) {
+			continue
+		}
+		found = append(found, newEntity(body, KindMention, start, end, strings.ToLower(body[start+1:end])))
+	}
+
+	sort.Slice(found, func(i, j int) bool {
+		return found[i].ByteStart < found[j].ByteStart
+	})
+	return found
+}
+
+// NormalizeHashtag turns user input such as "#Golang" into the form stored
+// for hashtag entities.
+func NormalizeHashtag(tag string) string {
+	return strings.ToLower(strings.TrimPrefix(tag, "#"))
+}
+
+func newEntity(body string, kind Kind, start, end int, normalized string) Entity {
+	charStart := utf8.RuneCountInString(body[:start])
+	return Entity{
+		Kind:       kind,
+		Text:       body[start:end],
+		Normalized: normalized,
+		ByteStart:  start,
+		ByteEnd:    end,
+		CharStart:  charStart,
+		CharEnd:    charStart + utf8.RuneCountInString(body[start:end]),
+	}
+}
+
+func overlaps(entities []Entity, start, end int) bool {
+	for _, e := range entities {
+		if start < e.ByteEnd && e.ByteStart < end {
+			return true
+		}
+	}
+	return false
+}
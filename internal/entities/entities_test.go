@@ -0,0 +1,83 @@
+package entities
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []Entity
+	}{
+		{
+			name: "No entities",
+			body: "just a plain chirp",
+			want: nil,
+		},
+		{
+			name: "Hashtag and mention",
+			body: "Hello @Alice, loving #GoLang",
+			want: []Entity{
+				{Kind: KindMention, Text: "@Alice", Normalized: "alice", ByteStart: 6, ByteEnd: 12, CharStart: 6, CharEnd: 12},
+				{Kind: KindHashtag, Text: "#GoLang", Normalized: "golang", ByteStart: 21, ByteEnd: 28, CharStart: 21, CharEnd: 28},
+			},
+		},
+		{
+			name: "URL with trailing punctuation",
+			body: "see https://example.com/a?b=1#frag.",
+			want: []Entity{
+				{Kind: KindURL, Text: "https://example.com/a?b=1#frag", Normalized: "https://example.com/a?b=1#frag", ByteStart: 4, ByteEnd: 34, CharStart: 4, CharEnd: 34},
+			},
+		},
+		{
+			name: "Multibyte characters shift byte offsets only",
+			body: "héllo #café",
+			want: []Entity{
+				{Kind: KindHashtag, Text: "#café", Normalized: "café", ByteStart: 7, ByteEnd: 13, CharStart: 6, CharEnd: 11},
+			},
+		},
+		{
+			name: "Email address is not a mention",
+			body: "mail me at bob@example.com",
+			want: nil,
+		},
+		{
+			name: "Numeric hashtag is ignored",
+			body: "we're #1",
+			want: nil,
+		},
+		{
+			name: "Mention at start of body",
+			body: "@bob hi",
+			want: []Entity{
+				{Kind: KindMention, Text: "@bob", Normalized: "bob", ByteStart: 0, ByteEnd: 4, CharStart: 0, CharEnd: 4},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Parse(tt.body)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse(%q) = %+v, want %+v", tt.body, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeHashtag(t *testing.T) {
+	tests := []struct {
+		tag  string
+		want string
+	}{
+		{tag: "#Golang", want: "golang"},
+		{tag: "chirpy", want: "chirpy"},
+	}
+	for _, tt := range tests {
+		if got := NormalizeHashtag(tt.tag); got != tt.want {
+			t.Errorf("NormalizeHashtag(%q) = %q, want %q", tt.tag, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package mail
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormat(t *testing.T) {
+	date := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		msg     Message
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "Plain message",
+			msg:  Message{To: "walt@example.com", Subject: "Hello", Body: "line one\nline two"},
+			want: []string{
+				"From: chirpy@example.com\r\n",
+				"To: walt@example.com\r\n",
+				"Subject: Hello\r\n",
+				"Date: Wed, 01 May 2024 12:00:00 +0000\r\n",
+				"\r\n\r\nline one\r\nline two",
+			},
+		},
+		{
+			name:    "Header injection",
+			msg:     Message{To: "walt@example.com\r\nBcc: jesse@example.com", Subject: "Hello"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Format("chirpy@example.com", tt.msg, date)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Format() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(string(got), want) {
+					t.Errorf("Format() = %q, want it to contain %q", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestOutboxMailer(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "outbox")
+	m := &OutboxMailer{Dir: dir, From: "chirpy@example.com"}
+
+	for _, to := range []string{"walt@example.com", "jesse@example.com"} {
+		if err := m.Send(context.Background(), Message{To: to, Subject: "Hi", Body: "token"}); err != nil {
+			t.Fatalf("Send() error = %v", err)
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir() error = %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("got %d messages in outbox, want 2", len(entries))
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, entries[1].Name()))
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	if !strings.Contains(string(data), "To: jesse@example.com\r\n") {
+		t.Errorf("outbox message = %q, want recipient jesse@example.com", data)
+	}
+}
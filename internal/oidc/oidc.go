@@ -0,0 +1,368 @@
+// Package oidc signs users in through an external OpenID Connect provider
+// using the authorization code flow with PKCE.
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Skorgum/Chirpy/internal/auth"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Config identifies Chirpy to a provider. RedirectURL is where the provider
+// sends the browser back to with the authorization code.
+type Config struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+// Metadata is the part of a provider's discovery document Chirpy uses.
+type Metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Identity is who the provider says signed in.
+type Identity struct {
+	Issuer        string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// CanLinkByEmail reports whether identity, seen for the first time, may be
+// linked to the existing account with the same email address.
+// accountEmailVerified is whether that account has proved it owns the
+// address. Both sides must have: if only the provider has, the account may
+// have been registered by someone else ahead of the address's owner, who
+// would then be signed in to an account the other person can still use.
+func CanLinkByEmail(identity Identity, accountEmailVerified bool) bool {
+	return identity.Email != "" && identity.EmailVerified && accountEmailVerified
+}
+
+// ErrNonceMismatch means an ID token wasn't issued for the login in
+// progress, which is what a replayed token looks like.
+var ErrNonceMismatch = errors.New("oidc: ID token nonce does not match")
+
+// jwksRefreshInterval limits how often an unknown kid makes the provider's
+// keys be fetched again.
+const jwksRefreshInterval = time.Minute
+
+// Provider talks to one OpenID Connect provider. Its discovery document and
+// keys are fetched on first use and cached.
+type Provider struct {
+	config Config
+	client *http.Client
+
+	mu            sync.Mutex
+	metadata      *Metadata
+	keys          map[string]any
+	keysFetchedAt time.Time
+}
+
+// NewProvider returns a Provider for config. client may be nil to use
+// http.DefaultClient.
+func NewProvider(config Config, client *http.Client) *Provider {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &Provider{config: config, client: client}
+}
+
+// Issuer returns the provider's configured issuer.
+func (p *Provider) Issuer() string {
+	return p.config.Issuer
+}
+
+// Metadata returns the provider's discovery document, fetching it the first
+// time.
+func (p *Provider) Metadata(ctx context.Context) (Metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.metadataLocked(ctx)
+}
+
+func (p *Provider) metadataLocked(ctx context.Context) (Metadata, error) {
+	if p.metadata != nil {
+		return *p.metadata, nil
+	}
+
+	var m Metadata
+	wellKnown := strings.TrimSuffix(p.config.Issuer, "/") + "/.well-known/openid-configuration"
+	if err := p.getJSON(ctx, wellKnown, &m); err != nil {
+		return Metadata{}, err
+	}
+	if m.Issuer != p.config.Issuer {
+		return Metadata{}, fmt.Errorf("oidc: discovery document is for issuer %q, want %q", m.Issuer, p.config.Issuer)
+	}
+	if m.AuthorizationEndpoint == "" || m.TokenEndpoint == "" || m.JWKSURI == "" {
+		return Metadata{}, errors.New("oidc: discovery document is missing an endpoint")
+	}
+	p.metadata = &m
+	return m, nil
+}
+
+// AuthCodeURL returns the provider URL to send the browser to. state and
+// nonce tie the eventual callback and ID token to this login, and
+// codeChallenge is the PKCE S256 challenge of the verifier to be passed to
+// Exchange.
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error) {
+	m, err := p.Metadata(ctx)
+	if err != nil {
+		return "", err
+	}
+	u, err := url.Parse(m.AuthorizationEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("oidc: invalid authorization endpoint: %w", err)
+	}
+
+	scopes := p.config.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{auth.ScopeOpenID, auth.ScopeEmail, auth.ScopeProfile}
+	}
+	q := u.Query()
+	q.Set("response_type", "code")
+	q.Set("client_id", p.config.ClientID)
+	q.Set("redirect_uri", p.config.RedirectURL)
+	q.Set("scope", strings.Join(scopes, " "))
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", codeChallenge)
+	q.Set("code_challenge_method", auth.PKCEMethodS256)
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// Exchange redeems an authorization code and returns the identity in the
+// verified ID token. nonce is the one sent with the authorization request.
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (Identity, error) {
+	m, err := p.Metadata(ctx)
+	if err != nil {
+		return Identity{}, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.config.RedirectURL},
+		"code_verifier": {codeVerifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Identity{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return Identity{}, err
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&body); err != nil {
+		return Identity{}, fmt.Errorf("oidc: token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return Identity{}, fmt.Errorf("oidc: token endpoint returned %d: %s %s", resp.StatusCode, body.Error, body.ErrorDescription)
+	}
+	if body.IDToken == "" {
+		return Identity{}, errors.New("oidc: token response has no ID token")
+	}
+
+	return p.verifyIDToken(ctx, m, body.IDToken, nonce)
+}
+
+func (p *Provider) verifyIDToken(ctx context.Context, m Metadata, idToken, nonce string) (Identity, error) {
+	var claims auth.IDTokenClaims
+	_, err := jwt.ParseWithClaims(idToken, &claims,
+		func(token *jwt.Token) (any, error) {
+			return p.verificationKey(ctx, token)
+		},
+		jwt.WithValidMethods([]string{"RS256", "ES256", "EdDSA"}),
+		jwt.WithIssuer(m.Issuer),
+		jwt.WithAudience(p.config.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
+	if err != nil {
+		return Identity{}, fmt.Errorf("oidc: invalid ID token: %w", err)
+	}
+
+	if len(claims.Audience) > 1 && claims.AuthorizedParty != p.config.ClientID {
+		return Identity{}, fmt.Errorf("oidc: ID token azp is %q, want %q", claims.AuthorizedParty, p.config.ClientID)
+	}
+	if subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1 {
+		return Identity{}, ErrNonceMismatch
+	}
+	if claims.Subject == "" {
+		return Identity{}, errors.New("oidc: ID token has no subject")
+	}
+
+	return Identity{
+		Issuer:        claims.Issuer,
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified != nil && *claims.EmailVerified,
+		Name:          claims.Name,
+	}, nil
+}
+
+// verificationKey finds the provider key named by the token's kid,
+// refetching the provider's keys if it is unknown, as happens after the
+// provider rotates them.
+func (p *Provider) verificationKey(ctx context.Context, token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key, ok := p.keys[kid]
+	if !ok && time.Since(p.keysFetchedAt) >= jwksRefreshInterval {
+		if err := p.fetchKeysLocked(ctx); err != nil {
+			return nil, err
+		}
+		key, ok = p.keys[kid]
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown key ID %q", kid)
+	}
+
+	var want string
+	switch key.(type) {
+	case *rsa.PublicKey:
+		want = "RS256"
+	case *ecdsa.PublicKey:
+		want = "ES256"
+	case ed25519.PublicKey:
+		want = "EdDSA"
+	}
+	if token.Method.Alg() != want {
+		return nil, fmt.Errorf("key %q is used with %s, not %s", kid, want, token.Method.Alg())
+	}
+	return key, nil
+}
+
+func (p *Provider) fetchKeysLocked(ctx context.Context) error {
+	m, err := p.metadataLocked(ctx)
+	if err != nil {
+		return err
+	}
+	var set auth.JWKSet
+	if err := p.getJSON(ctx, m.JWKSURI, &set); err != nil {
+		return err
+	}
+
+	keys := make(map[string]any, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := publicKey(jwk)
+		if err != nil {
+			// Skip key types Chirpy can't use rather than failing on
+			// every login.
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+	p.keys = keys
+	p.keysFetchedAt = time.Now()
+	return nil
+}
+
+// publicKey decodes an RSA, P-256 or Ed25519 public key from its JWK form.
+func publicKey(jwk auth.JWK) (any, error) {
+	decode := base64.RawURLEncoding.DecodeString
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decode(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if !exponent.IsInt64() || exponent.Int64() > 1<<31-1 {
+			return nil, errors.New("oidc: RSA exponent too large")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+	case "EC":
+		if jwk.Crv != "P-256" {
+			return nil, fmt.Errorf("oidc: unsupported curve %q", jwk.Crv)
+		}
+		x, err := decode(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !key.Curve.IsOnCurve(key.X, key.Y) {
+			return nil, errors.New("oidc: EC point is not on the curve")
+		}
+		return key, nil
+	case "OKP":
+		if jwk.Crv != "Ed25519" {
+			return nil, fmt.Errorf("oidc: unsupported curve %q", jwk.Crv)
+		}
+		x, err := decode(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("oidc: invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, fmt.Errorf("oidc: unsupported key type %q", jwk.Kty)
+}
+
+func (p *Provider) getJSON(ctx context.Context, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("oidc: GET %s returned %d", url, resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
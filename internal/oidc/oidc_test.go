@@ -0,0 +1,404 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Skorgum/Chirpy/internal/auth"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testClientID     = "chirpy"
+	testClientSecret = "s3cret/with+symbols"
+	testRedirectURL  = "https://chirpy.example.com/login/sso"
+)
+
+// mockIdP is a minimal OpenID Connect provider. It issues one
+// authorization code at a time, and claims lets a test change the ID token
+// it returns for it.
+type mockIdP struct {
+	t      *testing.T
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	kid    string
+
+	code          string
+	codeChallenge string
+	claims        func(c *auth.IDTokenClaims)
+	signingMethod jwt.SigningMethod
+	signingKey    any
+	jwksRequests  int
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %v", err)
+	}
+	idp := &mockIdP{t: t, key: key, kid: "idp-key-1"}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(Metadata{
+			Issuer:                idp.server.URL,
+			AuthorizationEndpoint: idp.server.URL + "/authorize",
+			TokenEndpoint:         idp.server.URL + "/token",
+			JWKSURI:               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		idp.jwksRequests++
+		json.NewEncoder(w).Encode(auth.JWKSet{Keys: []auth.JWK{{
+			Kty: "RSA",
+			Use: "sig",
+			Alg: "RS256",
+			Kid: idp.kid,
+			N:   base64.RawURLEncoding.EncodeToString(idp.key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(idp.key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("POST /token", idp.handleToken)
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+// authorize plays the part of the user approving the login at the
+// provider and returns the code it would redirect back with.
+func (idp *mockIdP) authorize(authURL string) (code string, params url.Values) {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		idp.t.Fatalf("Invalid authorization URL: %v", err)
+	}
+	params = u.Query()
+	idp.code = "code-" + params.Get("state")
+	idp.codeChallenge = params.Get("code_challenge")
+
+	nonce := params.Get("nonce")
+	base := idp.claims
+	idp.claims = func(c *auth.IDTokenClaims) {
+		c.Nonce = nonce
+		if base != nil {
+			base(c)
+		}
+	}
+	return idp.code, params
+}
+
+func (idp *mockIdP) handleToken(w http.ResponseWriter, r *http.Request) {
+	fail := func(status int, code string) {
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]string{"error": code})
+	}
+
+	id, secret, ok := r.BasicAuth()
+	if ok {
+		id, _ = url.QueryUnescape(id)
+		secret, _ = url.QueryUnescape(secret)
+	}
+	if !ok || id != testClientID || secret != testClientSecret {
+		fail(http.StatusUnauthorized, "invalid_client")
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		fail(http.StatusBadRequest, "invalid_request")
+		return
+	}
+	if r.PostForm.Get("code") != idp.code || r.PostForm.Get("redirect_uri") != testRedirectURL ||
+		auth.PKCEChallenge(r.PostForm.Get("code_verifier")) != idp.codeChallenge {
+		fail(http.StatusBadRequest, "invalid_grant")
+		return
+	}
+
+	verified := true
+	now := time.Now()
+	claims := auth.IDTokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    idp.server.URL,
+			Subject:   "user-123",
+			Audience:  jwt.ClaimStrings{testClientID},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(5 * time.Minute)),
+		},
+		Email:         "walt@example.com",
+		EmailVerified: &verified,
+		Name:          "Walter White",
+	}
+	if idp.claims != nil {
+		idp.claims(&claims)
+	}
+
+	method, key := idp.signingMethod, idp.signingKey
+	if method == nil {
+		method, key = jwt.SigningMethodRS256, idp.key
+	}
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = idp.kid
+	signed, err := token.SignedString(key)
+	if err != nil {
+		idp.t.Errorf("Failed to sign ID token: %v", err)
+		fail(http.StatusInternalServerError, "server_error")
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{
+		"access_token": "idp-access-token",
+		"token_type":   "Bearer",
+		"id_token":     signed,
+	})
+}
+
+func (idp *mockIdP) provider() *Provider {
+	return NewProvider(Config{
+		Issuer:       idp.server.URL,
+		ClientID:     testClientID,
+		ClientSecret: testClientSecret,
+		RedirectURL:  testRedirectURL,
+	}, idp.server.Client())
+}
+
+const testVerifier = "dBjftJeZ4CVP-mJ92K1D8F6NPA_ANz-xk9n2xZeJNZ0"
+
+func TestProviderLogin(t *testing.T) {
+	idp := newMockIdP(t)
+	p := idp.provider()
+	ctx := context.Background()
+
+	authURL, err := p.AuthCodeURL(ctx, "state-1", "nonce-1", auth.PKCEChallenge(testVerifier))
+	if err != nil {
+		t.Fatalf("AuthCodeURL() error = %v", err)
+	}
+	if !strings.HasPrefix(authURL, idp.server.URL+"/authorize?") {
+		t.Fatalf("AuthCodeURL() = %q, want the provider's authorization endpoint", authURL)
+	}
+	code, params := idp.authorize(authURL)
+	for name, want := range map[string]string{
+		"response_type":         "code",
+		"client_id":             testClientID,
+		"redirect_uri":          testRedirectURL,
+		"scope":                 "openid email profile",
+		"state":                 "state-1",
+		"nonce":                 "nonce-1",
+		"code_challenge_method": "S256",
+	} {
+		if got := params.Get(name); got != want {
+			t.Errorf("AuthCodeURL() %s = %q, want %q", name, got, want)
+		}
+	}
+
+	identity, err := p.Exchange(ctx, code, testVerifier, "nonce-1")
+	if err != nil {
+		t.Fatalf("Exchange() error = %v", err)
+	}
+	want := Identity{
+		Issuer:        idp.server.URL,
+		Subject:       "user-123",
+		Email:         "walt@example.com",
+		EmailVerified: true,
+		Name:          "Walter White",
+	}
+	if identity != want {
+		t.Errorf("Exchange() = %+v, want %+v", identity, want)
+	}
+}
+
+func TestProviderExchangeRejects(t *testing.T) {
+	hmacSecret := []byte("shared-secret")
+
+	tests := []struct {
+		name     string
+		claims   func(c *auth.IDTokenClaims)
+		sign     func(idp *mockIdP)
+		verifier string
+		nonce    string
+		wantErr  error
+	}{
+		{
+			name:  "Wrong nonce",
+			nonce: "other-nonce",
+			// The IdP echoes the nonce from the authorization request.
+			wantErr: ErrNonceMismatch,
+		},
+		{
+			name:   "Wrong audience",
+			claims: func(c *auth.IDTokenClaims) { c.Audience = jwt.ClaimStrings{"someone-else"} },
+		},
+		{
+			name: "Other audience is authorized party",
+			claims: func(c *auth.IDTokenClaims) {
+				c.Audience = jwt.ClaimStrings{testClientID, "someone-else"}
+				c.AuthorizedParty = "someone-else"
+			},
+		},
+		{
+			name:   "Wrong issuer",
+			claims: func(c *auth.IDTokenClaims) { c.Issuer = "https://evil.example.com" },
+		},
+		{
+			name:   "Expired",
+			claims: func(c *auth.IDTokenClaims) { c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute)) },
+		},
+		{
+			name: "Signed with another key",
+			sign: func(idp *mockIdP) {
+				other, err := rsa.GenerateKey(rand.Reader, 2048)
+				if err != nil {
+					t.Fatalf("Failed to generate RSA key: %v", err)
+				}
+				idp.signingMethod, idp.signingKey = jwt.SigningMethodRS256, other
+			},
+		},
+		{
+			name: "HMAC signed",
+			sign: func(idp *mockIdP) {
+				idp.signingMethod, idp.signingKey = jwt.SigningMethodHS256, hmacSecret
+			},
+		},
+		{
+			name:     "Wrong code verifier",
+			verifier: strings.Repeat("x", 43),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idp := newMockIdP(t)
+			idp.claims = tt.claims
+			if tt.sign != nil {
+				tt.sign(idp)
+			}
+			p := idp.provider()
+			ctx := context.Background()
+
+			authURL, err := p.AuthCodeURL(ctx, "state-1", "nonce-1", auth.PKCEChallenge(testVerifier))
+			if err != nil {
+				t.Fatalf("AuthCodeURL() error = %v", err)
+			}
+			code, _ := idp.authorize(authURL)
+
+			verifier, nonce := testVerifier, "nonce-1"
+			if tt.verifier != "" {
+				verifier = tt.verifier
+			}
+			if tt.nonce != "" {
+				nonce = tt.nonce
+			}
+			_, err = p.Exchange(ctx, code, verifier, nonce)
+			if err == nil {
+				t.Fatalf("Exchange() succeeded, want an error")
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("Exchange() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestProviderRefetchesKeys(t *testing.T) {
+	idp := newMockIdP(t)
+	p := idp.provider()
+	ctx := context.Background()
+
+	login := func() error {
+		authURL, err := p.AuthCodeURL(ctx, "state", "nonce", auth.PKCEChallenge(testVerifier))
+		if err != nil {
+			return err
+		}
+		code, _ := idp.authorize(authURL)
+		_, err = p.Exchange(ctx, code, testVerifier, "nonce")
+		return err
+	}
+
+	if err := login(); err != nil {
+		t.Fatalf("First login failed: %v", err)
+	}
+	if err := login(); err != nil {
+		t.Fatalf("Second login failed: %v", err)
+	}
+	if idp.jwksRequests != 1 {
+		t.Errorf("JWKS fetched %d times, want the keys cached after the first login", idp.jwksRequests)
+	}
+
+	// The provider rotates to a new key. It is picked up once the refresh
+	// interval has passed.
+	newKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %v", err)
+	}
+	idp.key, idp.kid = newKey, "idp-key-2"
+	p.keysFetchedAt = time.Now().Add(-jwksRefreshInterval)
+	if err := login(); err != nil {
+		t.Fatalf("Login after key rotation failed: %v", err)
+	}
+	if idp.jwksRequests != 2 {
+		t.Errorf("JWKS fetched %d times, want a refetch for the new key", idp.jwksRequests)
+	}
+}
+
+func TestProviderDiscoveryIssuerMismatch(t *testing.T) {
+	idp := newMockIdP(t)
+	p := NewProvider(Config{
+		Issuer:   idp.server.URL + "/",
+		ClientID: testClientID,
+	}, idp.server.Client())
+
+	if _, err := p.Metadata(context.Background()); err == nil {
+		t.Errorf("Metadata() accepted a discovery document for another issuer")
+	}
+}
+
+func TestCanLinkByEmail(t *testing.T) {
+	tests := []struct {
+		name                 string
+		identity             Identity
+		accountEmailVerified bool
+		want                 bool
+	}{
+		{
+			name:                 "Both verified",
+			identity:             Identity{Email: "walt@example.com", EmailVerified: true},
+			accountEmailVerified: true,
+			want:                 true,
+		},
+		{
+			// Someone registered the address before its owner signed in
+			// through the provider.
+			name:                 "Account never verified",
+			identity:             Identity{Email: "walt@example.com", EmailVerified: true},
+			accountEmailVerified: false,
+			want:                 false,
+		},
+		{
+			name:                 "Provider didn't verify",
+			identity:             Identity{Email: "walt@example.com", EmailVerified: false},
+			accountEmailVerified: true,
+			want:                 false,
+		},
+		{
+			name:                 "No email",
+			identity:             Identity{EmailVerified: true},
+			accountEmailVerified: true,
+			want:                 false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CanLinkByEmail(tt.identity, tt.accountEmailVerified); got != tt.want {
+				t.Errorf("CanLinkByEmail() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
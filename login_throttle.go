@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Skorgum/Chirpy/internal/auth"
+	"github.com/Skorgum/Chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	throttleScopeAccount    = "account"
+	throttleScopeIP         = "ip"
+	throttleScopeResetEmail = "reset_email"
+	throttleScopeResetIP    = "reset_ip"
+)
+
+// loginThrottleKey identifies a login_throttles row: an email address or a
+// client IP.
+type loginThrottleKey struct {
+	Scope string
+	Key   string
+}
+
+// loginThrottleKeys returns the keys a login attempt for email from r counts
+// against. The email is counted whether or not it belongs to a user, so the
+// responses don't reveal which addresses are registered.
+func loginThrottleKeys(r *http.Request, email string) []loginThrottleKey {
+	return []loginThrottleKey{
+		{Scope: throttleScopeAccount, Key: strings.ToLower(strings.TrimSpace(email))},
+		{Scope: throttleScopeIP, Key: clientIP(r)},
+	}
+}
+
+// passwordResetThrottleKey returns the key a password reset request from r
+// counts against.
+func passwordResetThrottleKey(r *http.Request) loginThrottleKey {
+	return loginThrottleKey{Scope: throttleScopeResetIP, Key: clientIP(r)}
+}
+
+// passwordResetMailThrottleKey returns the key each password reset mail to
+// email counts against.
+func passwordResetMailThrottleKey(email string) loginThrottleKey {
+	return loginThrottleKey{Scope: throttleScopeResetEmail, Key: strings.ToLower(strings.TrimSpace(email))}
+}
+
+func lockoutPolicyFor(scope string) auth.LockoutPolicy {
+	switch scope {
+	case throttleScopeIP:
+		return auth.DefaultIPLockoutPolicy
+	case throttleScopeResetEmail:
+		return auth.DefaultResetEmailPolicy
+	case throttleScopeResetIP:
+		return auth.DefaultResetIPPolicy
+	}
+	return auth.DefaultAccountLockoutPolicy
+}
+
+// loginAttempt is a login attempt that has already been counted as a
+// failure against its throttle keys. Counting it before the credentials are
+// checked means a burst of parallel attempts can't all get in under the
+// limit; a successful attempt is taken off the counts again by
+// releaseLoginAttempt.
+type loginAttempt struct {
+	keys     []loginThrottleKey
+	userID   uuid.UUID
+	failures []int
+}
+
+// beginLoginAttempt counts an attempt against each of keys and refuses
+// further attempts for the backoff the new count calls for. If any of keys
+// is already throttled nothing is counted, and it returns how long the
+// caller has to wait instead. userID is only used for logging and may be
+// uuid.Nil for unknown emails.
+func (cfg *apiConfig) beginLoginAttempt(ctx context.Context, keys []loginThrottleKey, userID uuid.UUID) (*loginAttempt, time.Duration, error) {
+	now := cfg.clock()
+
+	tx, err := cfg.dbConn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	// Every attempt locks its rows in the same order, account before IP,
+	// so two attempts can't deadlock.
+	throttles := make([]database.LoginThrottle, len(keys))
+	var wait time.Duration
+	for i, k := range keys {
+		err := qtx.CreateLoginThrottle(ctx, database.CreateLoginThrottleParams{
+			Scope: k.Scope,
+			Key:   k.Key,
+			Now:   now,
+		})
+		if err != nil {
+			return nil, 0, err
+		}
+		throttles[i], err = qtx.GetLoginThrottleForUpdate(ctx, database.GetLoginThrottleForUpdateParams{
+			Scope: k.Scope,
+			Key:   k.Key,
+		})
+		if err != nil {
+			return nil, 0, err
+		}
+		if remaining := throttles[i].LockedUntil.Sub(now); remaining > wait {
+			wait = remaining
+		}
+	}
+	if wait > 0 {
+		return nil, wait, nil
+	}
+
+	attempt := &loginAttempt{keys: keys, userID: userID, failures: make([]int, len(keys))}
+	for i, k := range keys {
+		policy := lockoutPolicyFor(k.Scope)
+		failures := int(throttles[i].Failures) + 1
+		if now.Sub(throttles[i].LastFailureAt) > policy.Window {
+			failures = 1
+		}
+		err := qtx.RecordLoginFailure(ctx, database.RecordLoginFailureParams{
+			Failures:      int32(failures),
+			LastFailureAt: now,
+			LockedUntil:   now.Add(policy.Backoff(failures)),
+			Scope:         k.Scope,
+			Key:           k.Key,
+		})
+		if err != nil {
+			return nil, 0, err
+		}
+		attempt.failures[i] = failures
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, 0, err
+	}
+	return attempt, 0, nil
+}
+
+// failed logs the lockouts a failed attempt brought on. The failure itself
+// was counted when the attempt began.
+func (a *loginAttempt) failed() {
+	for i, k := range a.keys {
+		policy := lockoutPolicyFor(k.Scope)
+		if a.failures[i] == policy.LockoutThreshold {
+			logSecurityEvent("login_lockout", a.userID, "%s %q locked out for %s after %d failed logins",
+				k.Scope, k.Key, policy.LockoutDuration, a.failures[i])
+		}
+	}
+}
+
+// releaseLoginAttempt takes a successful attempt off the counts it was
+// added to, along with any delay it brought on.
+func (cfg *apiConfig) releaseLoginAttempt(ctx context.Context, attempt *loginAttempt) error {
+	tx, err := cfg.dbConn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	for _, k := range attempt.keys {
+		throttle, err := qtx.GetLoginThrottleForUpdate(ctx, database.GetLoginThrottleForUpdateParams{
+			Scope: k.Scope,
+			Key:   k.Key,
+		})
+		if err != nil {
+			// An admin may have cleared the key in the meantime.
+			if errors.Is(err, sql.ErrNoRows) {
+				continue
+			}
+			return err
+		}
+		failures := max(int(throttle.Failures)-1, 0)
+		err = qtx.ReleaseLoginFailure(ctx, database.ReleaseLoginFailureParams{
+			Failures:    int32(failures),
+			LockedUntil: throttle.LastFailureAt.Add(lockoutPolicyFor(k.Scope).Backoff(failures)),
+			Scope:       k.Scope,
+			Key:         k.Key,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// abandonLoginAttempt releases an attempt that a server error cut short, so
+// the error doesn't count towards a lockout. A failure to release it is only
+// logged, since the caller is already reporting an error.
+func (cfg *apiConfig) abandonLoginAttempt(ctx context.Context, attempt *loginAttempt) {
+	if err := cfg.releaseLoginAttempt(ctx, attempt); err != nil {
+		log.Printf("Couldn't release login attempt for user %s: %v", attempt.userID, err)
+	}
+}
+
+// clearLoginFailures forgets the failed attempts against an account after a
+// successful login. The client IP keeps its count, since one success
+// doesn't vouch for everything else coming from that address.
+func (cfg *apiConfig) clearLoginFailures(ctx context.Context, email string) error {
+	_, err := cfg.db.ClearLoginThrottle(ctx, database.ClearLoginThrottleParams{
+		Scope: throttleScopeAccount,
+		Key:   strings.ToLower(strings.TrimSpace(email)),
+	})
+	return err
+}
+
+func respondWithTooManyAttempts(w http.ResponseWriter, wait time.Duration, msg string) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	respondWithError(w, http.StatusTooManyRequests, msg, nil)
+}
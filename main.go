@@ -1,25 +1,61 @@
 package main
 
 import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"net/smtp"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
 	"sync/atomic"
+	"syscall"
+	"time"
 
+	"github.com/Skorgum/Chirpy/internal/auth"
 	"github.com/Skorgum/Chirpy/internal/database"
+	"github.com/Skorgum/Chirpy/internal/mail"
+	"github.com/Skorgum/Chirpy/internal/oidc"
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
 )
 
 type apiConfig struct {
-	fileserverHits atomic.Int32
-	db             *database.Queries
-	platform       string
-	jwtSecret      string
-	polkaKey       string
+	fileserverHits    atomic.Int32
+	db                *database.Queries
+	dbConn            *sql.DB
+	platform          string
+	jwtKeys           *auth.Keyring
+	polkaKey          string
+	refreshTokenKey   []byte
+	tokenLifetimes    auth.PlanTokenLifetimes
+	mailer            mail.Mailer
+	adminAPIKey       string
+	passwordPolicy    auth.PasswordPolicy
+	passwordParams    auth.PasswordParams
+	passwordRehashes  atomic.Int64
+	oauthAuthorizeURL string
+	oidcProvider      *oidc.Provider
+	// background tracks work that outlives the request that started it,
+	// so shutdown can wait for it. Start it with runInBackground.
+	background sync.WaitGroup
+	// dummyPasswordHash is checked in place of a real hash when a login
+	// names an unknown email, so the response takes just as long.
+	dummyPasswordHash string
+
+	requireVerifiedEmail bool
+	// clock is the current time for checks that tests need to control,
+	// such as TOTP codes.
+	clock func() time.Time
 }
 
 func main() {
@@ -36,15 +72,51 @@ func main() {
 	if platform == "" {
 		log.Fatal("PLATFORM environment variable is not set")
 	}
-	jwtSecret := os.Getenv("JWT_SECRET")
-	if jwtSecret == "" {
-		log.Fatal("JWT_SECRET environment variable is not set")
+	jwtKeys, err := keyringFromEnv()
+	if err != nil {
+		log.Fatalf("Error loading JWT keys: %v", err)
 	}
 	polkaKey := os.Getenv("POLKA_KEY")
 	if polkaKey == "" {
 		log.Fatal("POLKA_KEY environment variable is not set")
 	}
 
+	refreshTokenKey, err := refreshTokenKeyFromEnv()
+	if err != nil {
+		log.Fatalf("Error configuring refresh tokens: %v", err)
+	}
+	lifetimes, err := tokenLifetimesFromEnv()
+	if err != nil {
+		log.Fatalf("Error configuring token lifetimes: %v", err)
+	}
+	mailer, err := mailerFromEnv()
+	if err != nil {
+		log.Fatalf("Error configuring mail: %v", err)
+	}
+	requireVerifiedEmail := os.Getenv("REQUIRE_VERIFIED_EMAIL") == "true"
+	adminAPIKey := os.Getenv("ADMIN_API_KEY")
+	passwordPolicy, err := passwordPolicyFromEnv()
+	if err != nil {
+		log.Fatalf("Error configuring password policy: %v", err)
+	}
+	oidcProvider, err := oidcProviderFromEnv()
+	if err != nil {
+		log.Fatalf("Error configuring single sign-on: %v", err)
+	}
+	passwordParams, err := passwordParamsFromEnv()
+	if err != nil {
+		log.Fatalf("Error configuring password hashing: %v", err)
+	}
+
+	dummyPassword, err := auth.MakeToken()
+	if err != nil {
+		log.Fatalf("Error creating dummy password: %v", err)
+	}
+	dummyPasswordHash, err := auth.HashPassword(dummyPassword, passwordParams)
+	if err != nil {
+		log.Fatalf("Error hashing dummy password: %v", err)
+	}
+
 	db, err := sql.Open("postgres", dbURL)
 	if err != nil {
 		log.Fatalf("Error connecting to database: %v", err)
@@ -54,11 +126,32 @@ func main() {
 	dbQueries := database.New(db)
 
 	apiCfg := apiConfig{
-		fileserverHits: atomic.Int32{},
-		db:             dbQueries,
-		platform:       platform,
-		jwtSecret:      jwtSecret,
-		polkaKey:       polkaKey,
+		fileserverHits:    atomic.Int32{},
+		db:                dbQueries,
+		dbConn:            db,
+		platform:          platform,
+		jwtKeys:           jwtKeys,
+		polkaKey:          polkaKey,
+		refreshTokenKey:   refreshTokenKey,
+		tokenLifetimes:    lifetimes,
+		mailer:            mailer,
+		adminAPIKey:       adminAPIKey,
+		passwordPolicy:    passwordPolicy,
+		passwordParams:    passwordParams,
+		oauthAuthorizeURL: os.Getenv("OAUTH_AUTHORIZE_URL"),
+		oidcProvider:      oidcProvider,
+		dummyPasswordHash: dummyPasswordHash,
+
+		requireVerifiedEmail: requireVerifiedEmail,
+		clock:                time.Now,
+	}
+
+	hashed, err := apiCfg.hashLegacyRefreshTokens(context.Background())
+	if err != nil {
+		log.Fatalf("Error hashing stored refresh tokens: %v", err)
+	}
+	if hashed > 0 {
+		log.Printf("Hashed %d refresh tokens stored in plain text", hashed)
 	}
 
 	const filepathRoot = "."
@@ -68,26 +161,218 @@ func main() {
 
 	mux.Handle("/app/", apiCfg.middlewareMetricsInc(http.StripPrefix("/app", http.FileServer(http.Dir(filepathRoot)))))
 	mux.HandleFunc("GET /api/healthz", handlerReadiness)
+	mux.HandleFunc("GET /.well-known/jwks.json", apiCfg.handlerJWKS)
+	mux.HandleFunc("GET /.well-known/openid-configuration", apiCfg.handlerOIDCDiscovery)
 	mux.HandleFunc("GET /admin/metrics", apiCfg.handlerMetrics)
 	mux.HandleFunc("POST /admin/reset", apiCfg.handlerReset)
+	mux.HandleFunc("GET /admin/metrics/passwords", apiCfg.handlerPasswordMetrics)
+	mux.HandleFunc("GET /admin/lockouts", apiCfg.handlerLockoutsGet)
+	mux.HandleFunc("DELETE /admin/lockouts/{scope}/{key}", apiCfg.handlerLockoutDelete)
 	mux.HandleFunc("POST /api/users", apiCfg.handlerUsersCreate)
 	mux.HandleFunc("POST /api/chirps", apiCfg.handlerChirpsCreate)
 	mux.HandleFunc("GET /api/chirps", apiCfg.handlerChirpsGetAll)
+	mux.HandleFunc("GET /api/chirps/search", apiCfg.handlerChirpsSearch)
 	mux.HandleFunc("GET /api/chirps/{chirpID}", apiCfg.handlerChirpsGet)
 	mux.HandleFunc("POST /api/login", apiCfg.handlerLogin)
+	mux.HandleFunc("POST /api/login/mfa", apiCfg.handlerLoginMFA)
+	mux.HandleFunc("POST /api/login/oidc", apiCfg.handlerOIDCLoginStart)
+	mux.HandleFunc("POST /api/login/oidc/callback", apiCfg.handlerOIDCLoginCallback)
+	mux.HandleFunc("POST /api/mfa/totp", apiCfg.handlerTOTPEnroll)
+	mux.HandleFunc("POST /api/mfa/totp/confirm", apiCfg.handlerTOTPConfirm)
+	mux.HandleFunc("DELETE /api/mfa/totp", apiCfg.handlerTOTPDelete)
+	mux.HandleFunc("POST /api/mfa/recovery-codes", apiCfg.handlerRecoveryCodesRegenerate)
 	mux.HandleFunc("POST /api/refresh", apiCfg.handlerRefresh)
 	mux.HandleFunc("POST /api/revoke", apiCfg.handlerRevoke)
+	mux.HandleFunc("GET /api/sessions", apiCfg.handlerSessionsGet)
+	mux.HandleFunc("DELETE /api/sessions/{sessionID}", apiCfg.handlerSessionDelete)
+	mux.HandleFunc("POST /api/sessions/revoke-all", apiCfg.handlerSessionsRevokeAll)
+	mux.HandleFunc("POST /api/tokens", apiCfg.handlerTokensCreate)
+	mux.HandleFunc("GET /api/tokens", apiCfg.handlerTokensGet)
+	mux.HandleFunc("DELETE /api/tokens/{tokenID}", apiCfg.handlerTokenDelete)
+	mux.HandleFunc("POST /api/oauth/clients", apiCfg.handlerOAuthClientsCreate)
+	mux.HandleFunc("GET /api/oauth/clients", apiCfg.handlerOAuthClientsGet)
+	mux.HandleFunc("DELETE /api/oauth/clients/{clientID}", apiCfg.handlerOAuthClientDelete)
+	mux.HandleFunc("GET /api/oauth/consents", apiCfg.handlerOAuthConsentsGet)
+	mux.HandleFunc("DELETE /api/oauth/consents/{clientID}", apiCfg.handlerOAuthConsentDelete)
+	mux.HandleFunc("GET /api/oauth/authorize", apiCfg.handlerOAuthAuthorizeGet)
+	mux.HandleFunc("POST /api/oauth/authorize", apiCfg.handlerOAuthAuthorize)
+	mux.HandleFunc("POST /api/oauth/token", apiCfg.handlerOAuthToken)
+	mux.HandleFunc("GET /api/oauth/userinfo", apiCfg.handlerOAuthUserInfo)
+	mux.HandleFunc("POST /api/oauth/userinfo", apiCfg.handlerOAuthUserInfo)
+	mux.HandleFunc("POST /api/password/forgot", apiCfg.handlerPasswordForgot)
+	mux.HandleFunc("POST /api/password/reset", apiCfg.handlerPasswordReset)
 	mux.HandleFunc("PUT /api/users", apiCfg.handlerUsersUpdate)
+	mux.HandleFunc("PATCH /api/users", apiCfg.handlerUsersUpdate)
+	mux.HandleFunc("POST /api/users/verify", apiCfg.handlerUsersVerify)
+	mux.HandleFunc("POST /api/users/verify/resend", apiCfg.handlerUsersVerifyResend)
+	mux.HandleFunc("POST /api/users/email/confirm", apiCfg.handlerUsersEmailConfirm)
+	mux.HandleFunc("GET /api/users/{idOrHandle}", apiCfg.handlerUsersGet)
+	mux.HandleFunc("PUT /api/chirps/{chirpID}", apiCfg.handlerChirpsUpdate)
+	mux.HandleFunc("GET /api/chirps/{chirpID}/revisions", apiCfg.handlerChirpRevisionsGet)
+	mux.HandleFunc("GET /api/chirps/{chirpID}/thread", apiCfg.handlerChirpThreadGet)
+	mux.HandleFunc("POST /api/chirps/{chirpID}/likes", apiCfg.handlerLikeCreate)
+	mux.HandleFunc("DELETE /api/chirps/{chirpID}/likes", apiCfg.handlerLikeDelete)
+	mux.HandleFunc("GET /api/chirps/{chirpID}/likes", apiCfg.handlerLikesGet)
+	mux.HandleFunc("POST /api/chirps/{chirpID}/rechirp", apiCfg.handlerRechirpCreate)
+	mux.HandleFunc("DELETE /api/chirps/{chirpID}/rechirp", apiCfg.handlerRechirpDelete)
 	mux.HandleFunc("DELETE /api/chirps/{chirpID}", apiCfg.handlerDeleteChirp)
 	mux.HandleFunc("POST /api/polka/webhooks", apiCfg.handlerPolkaWebhooks)
+	mux.HandleFunc("POST /api/users/{userID}/follow", apiCfg.handlerFollowCreate)
+	mux.HandleFunc("DELETE /api/users/{userID}/follow", apiCfg.handlerFollowDelete)
+	mux.HandleFunc("GET /api/users/{userID}/followers", apiCfg.handlerFollowersGet)
+	mux.HandleFunc("GET /api/users/{userID}/following", apiCfg.handlerFollowingGet)
+	mux.HandleFunc("GET /api/users/{userID}/mentions", apiCfg.handlerMentionChirpsGet)
+	mux.HandleFunc("GET /api/timeline", apiCfg.handlerTimeline)
+	mux.HandleFunc("GET /api/hashtags/{tag}/chirps", apiCfg.handlerHashtagChirpsGet)
 
 	server := &http.Server{
 		Addr:    port,
 		Handler: mux,
 	}
 
-	log.Printf("Serving files from %s on port: %s\n", filepathRoot, port)
-	log.Fatal(server.ListenAndServe())
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		log.Printf("Serving files from %s on port: %s\n", filepathRoot, port)
+		if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}()
+
+	<-ctx.Done()
+	log.Println("Shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Error shutting down: %v", err)
+	}
+	apiCfg.background.Wait()
+}
+
+// shutdownTimeout is how long in-flight requests get to finish once the
+// server has been told to stop.
+const shutdownTimeout = 30 * time.Second
+
+// runInBackground runs fn in a new goroutine that shutdown waits for. fn
+// should bound its own run time, since the wait has no timeout.
+func (cfg *apiConfig) runInBackground(fn func()) {
+	cfg.background.Add(1)
+	go func() {
+		defer cfg.background.Done()
+		fn()
+	}()
+}
+
+// refreshTokenKeyFromEnv returns REFRESH_TOKEN_KEY, the key refresh tokens
+// are hashed with. Deployments from before it existed can leave it unset, and the key
+// is then derived from JWT_SECRET so they keep starting. That key changes
+// whenever JWT_SECRET does, which signs everyone out, so a warning asks for
+// REFRESH_TOKEN_KEY to be set to a random value of its own. Changing
+// REFRESH_TOKEN_KEY itself also signs everyone out.
+func refreshTokenKeyFromEnv() ([]byte, error) {
+	if key := os.Getenv("REFRESH_TOKEN_KEY"); key != "" {
+		return []byte(key), nil
+	}
+	secret := os.Getenv("JWT_SECRET")
+	if secret == "" {
+		return nil, errors.New("REFRESH_TOKEN_KEY is not set; set it to a long random value, e.g. the output of `openssl rand -base64 32`")
+	}
+	log.Println("Warning: REFRESH_TOKEN_KEY is not set, deriving it from JWT_SECRET. " +
+		"Set REFRESH_TOKEN_KEY to a long random value; until then, changing JWT_SECRET signs everyone out.")
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("chirpy refresh token key"))
+	return mac.Sum(nil), nil
+}
+
+// keyringFromEnv loads the JWT keys. JWT_SECRET, if set, is an HS256 key
+// with the legacy key ID. JWT_KEYS_DIR may hold more keys as PEM files named
+// <kid>.pem; public-key-only files are kept for verifying tokens signed by a
+// retired key. JWT_SIGNING_KEY_ID picks the key new tokens are signed with,
+// and JWT_ISSUER and JWT_AUDIENCE override the iss and aud claims.
+func keyringFromEnv() (*auth.Keyring, error) {
+	var keys []*auth.Key
+	if secret := os.Getenv("JWT_SECRET"); secret != "" {
+		keys = append(keys, auth.NewHMACKey(auth.LegacyKeyID, []byte(secret)))
+	}
+
+	if dir := os.Getenv("JWT_KEYS_DIR"); dir != "" {
+		paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range paths {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return nil, err
+			}
+			key, err := auth.ParsePEMKey(strings.TrimSuffix(filepath.Base(path), ".pem"), data)
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, key)
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("neither JWT_SECRET nor JWT_KEYS_DIR is set")
+	}
+
+	signingID := os.Getenv("JWT_SIGNING_KEY_ID")
+	if signingID == "" {
+		signingID = auth.LegacyKeyID
+	}
+	kr, err := auth.NewKeyring(signingID, keys...)
+	if err != nil {
+		return nil, err
+	}
+	if issuer := os.Getenv("JWT_ISSUER"); issuer != "" {
+		kr.Issuer = issuer
+	}
+	if audience := os.Getenv("JWT_AUDIENCE"); audience != "" {
+		kr.Audience = audience
+	}
+	return kr, nil
+}
+
+// mailerFromEnv picks the mail backend from MAIL_DRIVER: "log" (the
+// default), "smtp" or "outbox".
+func mailerFromEnv() (mail.Mailer, error) {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "Chirpy <no-reply@chirpy.local>"
+	}
+
+	switch driver := os.Getenv("MAIL_DRIVER"); driver {
+	case "", "log":
+		return mail.LogMailer{}, nil
+	case "smtp":
+		addr := os.Getenv("SMTP_ADDR")
+		if addr == "" {
+			return nil, fmt.Errorf("SMTP_ADDR environment variable is not set")
+		}
+		var smtpAuth smtp.Auth
+		if username := os.Getenv("SMTP_USERNAME"); username != "" {
+			host, _, err := net.SplitHostPort(addr)
+			if err != nil {
+				return nil, fmt.Errorf("invalid SMTP_ADDR: %w", err)
+			}
+			smtpAuth = smtp.PlainAuth("", username, os.Getenv("SMTP_PASSWORD"), host)
+		}
+		return mail.SMTPMailer{Addr: addr, From: from, Auth: smtpAuth}, nil
+	case "outbox":
+		dir := os.Getenv("MAIL_OUTBOX_DIR")
+		if dir == "" {
+			dir = "outbox"
+		}
+		return &mail.OutboxMailer{Dir: dir, From: from}, nil
+	default:
+		return nil, fmt.Errorf("unknown MAIL_DRIVER %q", driver)
+	}
+}
+
+func (cfg *apiConfig) handlerJWKS(w http.ResponseWriter, r *http.Request) {
+	respondWithJSON(w, http.StatusOK, cfg.jwtKeys.JWKS())
 }
 
 func handlerReadiness(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// pageCursor is the keyset position of the last row on a page. Rows are
+// ordered by (created_at, id) so the cursor stays stable when rows share a
+// timestamp.
+type pageCursor struct {
+	CreatedAt time.Time
+	ID        uuid.UUID
+}
+
+type pageParams struct {
+	Limit  int32
+	Desc   bool
+	Cursor pageCursor
+}
+
+// parsePageParams reads limit, cursor and sort from the query string. When no
+// cursor is given the first page is fetched with the same keyset query.
+func parsePageParams(query url.Values, defaultDesc bool) (pageParams, error) {
+	page := pageParams{Desc: defaultDesc}
+
+	switch query.Get("sort") {
+	case "":
+	case "asc":
+		page.Desc = false
+	case "desc":
+		page.Desc = true
+	default:
+		return pageParams{}, errors.New("sort must be asc or desc")
+	}
+
+	limit, err := parsePageLimit(query)
+	if err != nil {
+		return pageParams{}, err
+	}
+	page.Limit = limit
+
+	if cursorStr := query.Get("cursor"); cursorStr != "" {
+		cursor, err := decodeCursor(cursorStr)
+		if err != nil {
+			return pageParams{}, err
+		}
+		page.Cursor = cursor
+		return page, nil
+	}
+
+	page.Cursor = firstPageCursor(page.Desc)
+	return page, nil
+}
+
+// firstPageCursor returns a cursor that sorts before every row, or after
+// every row for descending pages.
+func firstPageCursor(desc bool) pageCursor {
+	if desc {
+		return pageCursor{
+			CreatedAt: time.Date(9999, time.December, 31, 0, 0, 0, 0, time.UTC),
+			ID:        uuid.Max,
+		}
+	}
+	return pageCursor{
+		CreatedAt: time.Date(1, time.January, 1, 0, 0, 0, 0, time.UTC),
+		ID:        uuid.Nil,
+	}
+}
+
+// parsePageLimit reads the limit query parameter, capping it at maxPageSize.
+func parsePageLimit(query url.Values) (int32, error) {
+	limitStr := query.Get("limit")
+	if limitStr == "" {
+		return defaultPageSize, nil
+	}
+	limit, err := strconv.Atoi(limitStr)
+	if err != nil || limit < 1 {
+		return 0, errors.New("limit must be a positive integer")
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+	return int32(limit), nil
+}
+
+func encodeCursor(c pageCursor) string {
+	raw := c.CreatedAt.UTC().Format(time.RFC3339Nano) + "|" + c.ID.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(s string) (pageCursor, error) {
+	errInvalid := errors.New("invalid cursor")
+
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return pageCursor{}, errInvalid
+	}
+	createdAtStr, idStr, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return pageCursor{}, errInvalid
+	}
+	createdAt, err := time.Parse(time.RFC3339Nano, createdAtStr)
+	if err != nil {
+		return pageCursor{}, errInvalid
+	}
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		return pageCursor{}, errInvalid
+	}
+	return pageCursor{CreatedAt: createdAt, ID: id}, nil
+}
+
+// setNextPageLink adds a Link header pointing at the following page. The
+// request URL is reused so filters such as author_id carry over.
+func setNextPageLink(w http.ResponseWriter, r *http.Request, page pageParams, next pageCursor) {
+	query := r.URL.Query()
+	query.Set("cursor", encodeCursor(next))
+	query.Set("limit", strconv.Itoa(int(page.Limit)))
+	if page.Desc {
+		query.Set("sort", "desc")
+	} else {
+		query.Set("sort", "asc")
+	}
+
+	setNextLink(w, r, query)
+}
+
+func setNextLink(w http.ResponseWriter, r *http.Request, query url.Values) {
+	nextURL := url.URL{Path: r.URL.Path, RawQuery: query.Encode()}
+	w.Header().Set("Link", "<"+nextURL.String()+`>; rel="next"`)
+}
+
+// parseNewestFirstPageParams is parsePageParams for endpoints that only
+// support newest-first ordering, such as the timeline and follow lists.
+func parseNewestFirstPageParams(r *http.Request) (pageParams, error) {
+	page, err := parsePageParams(r.URL.Query(), true)
+	if err != nil {
+		return pageParams{}, err
+	}
+	if !page.Desc {
+		return pageParams{}, errors.New("only sort=desc is supported")
+	}
+	return page, nil
+}
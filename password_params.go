@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+
+	"github.com/Skorgum/Chirpy/internal/auth"
+	"github.com/Skorgum/Chirpy/internal/database"
+)
+
+// passwordParamsFromEnv reads the argon2id settings for new password
+// hashes. ARGON2_MEMORY (KiB), ARGON2_ITERATIONS, ARGON2_PARALLELISM,
+// ARGON2_SALT_LENGTH and ARGON2_KEY_LENGTH each override one of
+// auth.DefaultPasswordParams. Existing hashes made with weaker settings are
+// upgraded the next time their owner logs in.
+func passwordParamsFromEnv() (auth.PasswordParams, error) {
+	params := auth.DefaultPasswordParams()
+
+	settings := []struct {
+		name  string
+		value *uint32
+		min   int
+	}{
+		{"ARGON2_MEMORY", &params.Memory, 8},
+		{"ARGON2_ITERATIONS", &params.Iterations, 1},
+		{"ARGON2_SALT_LENGTH", &params.SaltLength, 8},
+		{"ARGON2_KEY_LENGTH", &params.KeyLength, 16},
+	}
+	for _, s := range settings {
+		n, err := intFromEnv(s.name, int(*s.value))
+		if err != nil {
+			return params, err
+		}
+		if n < s.min || n > math.MaxUint32 {
+			return params, fmt.Errorf("invalid %s: must be at least %d", s.name, s.min)
+		}
+		*s.value = uint32(n)
+	}
+
+	parallelism, err := intFromEnv("ARGON2_PARALLELISM", int(params.Parallelism))
+	if err != nil {
+		return params, err
+	}
+	if parallelism < 1 || parallelism > math.MaxUint8 {
+		return params, fmt.Errorf("invalid ARGON2_PARALLELISM: must be between 1 and %d", math.MaxUint8)
+	}
+	params.Parallelism = uint8(parallelism)
+
+	// argon2id needs at least 8 KiB of memory per lane.
+	if params.Memory < 8*uint32(params.Parallelism) {
+		return params, fmt.Errorf("ARGON2_MEMORY must be at least %d KiB for %d lanes", 8*uint32(params.Parallelism), params.Parallelism)
+	}
+	return params, nil
+}
+
+// upgradePasswordHash rehashes a password that has just been checked against
+// user's stored hash if that hash was made with weaker settings than the
+// current ones. Failures are only logged: the login itself has succeeded.
+func (cfg *apiConfig) upgradePasswordHash(ctx context.Context, user database.User, password string) {
+	stale, err := auth.NeedsRehash(user.HashedPassword, cfg.passwordParams)
+	if err != nil || !stale {
+		return
+	}
+
+	hash, err := auth.HashPassword(password, cfg.passwordParams)
+	if err != nil {
+		log.Printf("Failed to rehash password for user %s: %v", user.ID, err)
+		return
+	}
+	// The old hash is part of the condition so a password changed in the
+	// meantime isn't overwritten.
+	updated, err := cfg.db.RehashUserPassword(ctx, database.RehashUserPasswordParams{
+		NewHash: hash,
+		ID:      user.ID,
+		OldHash: user.HashedPassword,
+	})
+	if err != nil {
+		log.Printf("Failed to store rehashed password for user %s: %v", user.ID, err)
+		return
+	}
+	if updated == 1 {
+		cfg.passwordRehashes.Add(1)
+	}
+}
+
+// handlerPasswordMetrics reports how many users still have password hashes
+// made with weaker settings than the current ones.
+func (cfg *apiConfig) handlerPasswordMetrics(w http.ResponseWriter, r *http.Request) {
+	if !cfg.requireAdmin(w, r) {
+		return
+	}
+
+	type response struct {
+		Params             auth.PasswordParams `json:"params"`
+		Users              int64               `json:"users"`
+		UsersOnOldParams   int64               `json:"users_on_old_params"`
+		UsersUnrecognised  int64               `json:"users_unrecognised"`
+		RehashedSinceStart int64               `json:"rehashed_since_start"`
+	}
+
+	groups, err := cfg.db.CountUsersByPasswordParams(r.Context())
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't count password hashes", err)
+		return
+	}
+
+	res := response{
+		Params:             cfg.passwordParams,
+		RehashedSinceStart: cfg.passwordRehashes.Load(),
+	}
+	for _, g := range groups {
+		res.Users += g.Users
+		// Users are grouped by the settings part of their hash and the
+		// encoded lengths of its salt and key, so stand-in salt and key of
+		// those lengths give a hash with the same shape.
+		shape := fmt.Sprintf("$argon2id$v=19$%s$%s$%s", g.Params,
+			strings.Repeat("A", int(g.SaltChars)), strings.Repeat("A", int(g.KeyChars)))
+		stale, err := auth.NeedsRehash(shape, cfg.passwordParams)
+		switch {
+		case err != nil:
+			res.UsersUnrecognised += g.Users
+		case stale:
+			res.UsersOnOldParams += g.Users
+		}
+	}
+
+	respondWithJSON(w, http.StatusOK, res)
+}
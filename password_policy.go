@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/Skorgum/Chirpy/internal/auth"
+)
+
+// passwordPolicyFromEnv starts from auth.DefaultPasswordPolicy.
+// PASSWORD_MIN_LENGTH and PASSWORD_MAX_LENGTH change the length limits,
+// PASSWORD_BANNED_FILE adds passwords to refuse (one per line), and
+// PWNED_PASSWORDS_DIR enables the breached password check against a local
+// copy of the Have I Been Pwned range files, with PWNED_PASSWORDS_MIN_COUNT
+// sightings needed to refuse a password.
+func passwordPolicyFromEnv() (auth.PasswordPolicy, error) {
+	policy := auth.DefaultPasswordPolicy()
+	var err error
+
+	if policy.MinLength, err = intFromEnv("PASSWORD_MIN_LENGTH", policy.MinLength); err != nil {
+		return policy, err
+	}
+	if policy.MaxLength, err = intFromEnv("PASSWORD_MAX_LENGTH", policy.MaxLength); err != nil {
+		return policy, err
+	}
+	if policy.MinLength < 1 || policy.MaxLength < policy.MinLength {
+		return policy, fmt.Errorf("invalid password length limits %d to %d", policy.MinLength, policy.MaxLength)
+	}
+
+	if path := os.Getenv("PASSWORD_BANNED_FILE"); path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			return policy, err
+		}
+		defer f.Close()
+		banned, err := auth.ReadPasswordList(f)
+		if err != nil {
+			return policy, fmt.Errorf("reading %s: %w", path, err)
+		}
+		for password := range banned {
+			policy.Banned[password] = true
+		}
+	}
+
+	if dir := os.Getenv("PWNED_PASSWORDS_DIR"); dir != "" {
+		info, err := os.Stat(dir)
+		if err != nil {
+			return policy, err
+		}
+		if !info.IsDir() {
+			return policy, fmt.Errorf("PWNED_PASSWORDS_DIR %s is not a directory", dir)
+		}
+		minCount, err := intFromEnv("PWNED_PASSWORDS_MIN_COUNT", 1)
+		if err != nil {
+			return policy, err
+		}
+		policy.Breached = &auth.PwnedPasswords{Dir: dir, MinCount: minCount}
+	}
+
+	return policy, nil
+}
+
+func intFromEnv(name string, fallback int) (int, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return n, nil
+}
+
+// checkPassword applies the password policy to a new password for the
+// account with the given email. If the password is refused it writes a 400
+// listing every violation and returns false.
+func (cfg *apiConfig) checkPassword(w http.ResponseWriter, password, email string) bool {
+	violations, err := cfg.passwordPolicy.Check(password, email)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check password", err)
+		return false
+	}
+	if len(violations) == 0 {
+		return true
+	}
+
+	respondWithJSON(w, http.StatusBadRequest, struct {
+		Error      string                   `json:"error"`
+		Violations []auth.PasswordViolation `json:"violations"`
+	}{
+		Error:      "Password does not meet the requirements",
+		Violations: violations,
+	})
+	return false
+}
@@ -0,0 +1,14 @@
+package main
+
+import (
+	"log"
+
+	"github.com/google/uuid"
+)
+
+// logSecurityEvent records something an operator may need to act on, such as
+// a stolen refresh token being replayed. Events share a prefix so they can be
+// filtered out of the regular server log.
+func logSecurityEvent(event string, userID uuid.UUID, format string, args ...any) {
+	log.Printf("SECURITY %s user=%s: "+format, append([]any{event, userID}, args...)...)
+}
@@ -0,0 +1,52 @@
+-- name: CreateChirpEntity :exec
+INSERT INTO chirp_entities (id, chirp_id, kind, text, normalized, user_id, byte_start, byte_end, char_start, char_end)
+VALUES (
+    gen_random_uuid(),
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    $7,
+    $8,
+    $9
+);
+
+-- name: DeleteChirpEntities :exec
+DELETE FROM chirp_entities
+WHERE chirp_id = $1;
+
+-- name: ListChirpEntities :many
+SELECT *
+FROM chirp_entities
+WHERE chirp_id = ANY(sqlc.arg(chirp_ids)::uuid[])
+ORDER BY chirp_id, byte_start;
+
+-- name: ListHashtagChirps :many
+SELECT * FROM chirps
+WHERE deleted_at IS NULL
+    AND EXISTS (
+        SELECT 1
+        FROM chirp_entities
+        WHERE chirp_entities.chirp_id = chirps.id
+            AND chirp_entities.kind = 'hashtag'
+            AND chirp_entities.normalized = sqlc.arg(tag)
+    )
+    AND (created_at, id) < (sqlc.arg(cursor_created_at)::timestamptz, sqlc.arg(cursor_id)::uuid)
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg('limit');
+
+-- name: ListMentionChirps :many
+SELECT * FROM chirps
+WHERE deleted_at IS NULL
+    AND EXISTS (
+        SELECT 1
+        FROM chirp_entities
+        WHERE chirp_entities.chirp_id = chirps.id
+            AND chirp_entities.kind = 'mention'
+            AND chirp_entities.user_id = sqlc.arg(user_id)
+    )
+    AND (created_at, id) < (sqlc.arg(cursor_created_at)::timestamptz, sqlc.arg(cursor_id)::uuid)
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg('limit');
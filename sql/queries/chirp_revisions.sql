@@ -0,0 +1,18 @@
+-- name: CreateChirpRevision :exec
+INSERT INTO chirp_revisions (id, chirp_id, body, created_at)
+VALUES (
+    gen_random_uuid(),
+    $1,
+    $2,
+    NOW()
+);
+
+-- name: ListChirpRevisions :many
+SELECT *
+FROM chirp_revisions
+WHERE chirp_id = $1
+ORDER BY created_at DESC, id DESC;
+
+-- name: DeleteChirpRevisions :exec
+DELETE FROM chirp_revisions
+WHERE chirp_id = $1;
@@ -1,23 +1,114 @@
 -- name: CreateChirp :one
-INSERT INTO chirps (id, created_at, updated_at, body, user_id)
-VALUES (    
-    gen_random_uuid(),
-  NOW(),
-  NOW(),
-  $1,
-  $2
+WITH new_chirp AS (
+    SELECT gen_random_uuid() AS id
 )
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, in_reply_to, conversation_id, quoted_chirp_id)
+SELECT
+    new_chirp.id,
+    NOW(),
+    NOW(),
+    sqlc.arg(body)::text,
+    sqlc.arg(user_id)::uuid,
+    sqlc.narg(in_reply_to)::uuid,
+    COALESCE(sqlc.narg(conversation_id)::uuid, new_chirp.id),
+    sqlc.narg(quoted_chirp_id)::uuid
+FROM new_chirp
 RETURNING *;
 
--- name: GetChirps :many
-SELECT id, created_at, updated_at, body, user_id
-FROM chirps
-ORDER BY created_at ASC;
+-- name: CreateRechirp :one
+WITH new_chirp AS (
+    SELECT gen_random_uuid() AS id
+)
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, conversation_id, rechirp_of)
+SELECT
+    new_chirp.id,
+    NOW(),
+    NOW(),
+    '',
+    sqlc.arg(user_id)::uuid,
+    new_chirp.id,
+    sqlc.arg(rechirp_of)::uuid
+FROM new_chirp
+ON CONFLICT DO NOTHING
+RETURNING *;
+
+-- name: ListChirpsAsc :many
+SELECT * FROM chirps
+WHERE deleted_at IS NULL
+    AND (created_at, id) > (sqlc.arg(cursor_created_at)::timestamptz, sqlc.arg(cursor_id)::uuid)
+ORDER BY created_at ASC, id ASC
+LIMIT sqlc.arg('limit');
+
+-- name: ListChirpsDesc :many
+SELECT * FROM chirps
+WHERE deleted_at IS NULL
+    AND (created_at, id) < (sqlc.arg(cursor_created_at)::timestamptz, sqlc.arg(cursor_id)::uuid)
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg('limit');
+
+-- name: ListChirpsByAuthorAsc :many
+SELECT * FROM chirps
+WHERE user_id = sqlc.arg(user_id)
+    AND deleted_at IS NULL
+    AND (created_at, id) > (sqlc.arg(cursor_created_at)::timestamptz, sqlc.arg(cursor_id)::uuid)
+ORDER BY created_at ASC, id ASC
+LIMIT sqlc.arg('limit');
+
+-- name: ListChirpsByAuthorDesc :many
+SELECT * FROM chirps
+WHERE user_id = sqlc.arg(user_id)
+    AND deleted_at IS NULL
+    AND (created_at, id) < (sqlc.arg(cursor_created_at)::timestamptz, sqlc.arg(cursor_id)::uuid)
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg('limit');
 
 -- name: GetChirp :one
 SELECT * FROM chirps
 WHERE id = $1;
 
+-- name: GetChirpsByIDs :many
+SELECT * FROM chirps
+WHERE id = ANY(sqlc.arg(ids)::uuid[]);
+
+-- name: GetChirpForUpdate :one
+SELECT * FROM chirps
+WHERE id = $1
+FOR UPDATE;
+
+-- name: UpdateChirpBody :one
+UPDATE chirps
+SET body = $2,
+    updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: ListConversationChirps :many
+SELECT * FROM chirps
+WHERE conversation_id = $1
+ORDER BY created_at ASC, id ASC;
+
 -- name: DeleteChirp :exec
+UPDATE chirps
+SET body = '',
+    deleted_at = NOW(),
+    updated_at = NOW()
+WHERE id = $1;
+
+-- name: DeleteRechirp :execrows
+DELETE FROM chirps
+WHERE user_id = $1
+    AND rechirp_of = $2;
+
+-- name: DeleteRechirpsOf :exec
 DELETE FROM chirps
-WHERE id = $1;
\ No newline at end of file
+WHERE rechirp_of = $1;
+
+-- name: ListTimelineChirps :many
+SELECT chirps.*
+FROM chirps
+JOIN follows ON follows.followee_id = chirps.user_id
+WHERE follows.follower_id = sqlc.arg(follower_id)
+    AND chirps.deleted_at IS NULL
+    AND (chirps.created_at, chirps.id) < (sqlc.arg(cursor_created_at)::timestamptz, sqlc.arg(cursor_id)::uuid)
+ORDER BY chirps.created_at DESC, chirps.id DESC
+LIMIT sqlc.arg('limit');
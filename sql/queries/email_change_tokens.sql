@@ -0,0 +1,22 @@
+-- name: CreateEmailChangeToken :exec
+INSERT INTO email_change_tokens (token_hash, user_id, new_email, created_at, expires_at)
+VALUES (
+    $1,
+    $2,
+    $3,
+    NOW(),
+    $4
+);
+
+-- name: ConsumeEmailChangeToken :one
+UPDATE email_change_tokens
+SET used_at = NOW()
+WHERE token_hash = $1
+    AND used_at IS NULL
+    AND expires_at > NOW()
+RETURNING *;
+
+-- name: DeletePendingEmailChangeTokens :exec
+DELETE FROM email_change_tokens
+WHERE user_id = $1
+    AND used_at IS NULL;
@@ -0,0 +1,21 @@
+-- name: CreateEmailVerificationToken :exec
+INSERT INTO email_verification_tokens (token_hash, user_id, created_at, expires_at)
+VALUES (
+    $1,
+    $2,
+    NOW(),
+    $3
+);
+
+-- name: ConsumeEmailVerificationToken :one
+UPDATE email_verification_tokens
+SET used_at = NOW()
+WHERE token_hash = $1
+    AND used_at IS NULL
+    AND expires_at > NOW()
+RETURNING *;
+
+-- name: DeletePendingEmailVerificationTokens :exec
+DELETE FROM email_verification_tokens
+WHERE user_id = $1
+    AND used_at IS NULL;
@@ -0,0 +1,45 @@
+-- name: GetExternalIdentity :one
+SELECT *
+FROM external_identities
+WHERE issuer = $1
+    AND subject = $2;
+
+-- name: CreateExternalIdentity :one
+INSERT INTO external_identities (id, user_id, issuer, subject, email, created_at, last_login_at)
+VALUES (
+    gen_random_uuid(),
+    $1,
+    $2,
+    $3,
+    $4,
+    NOW(),
+    NOW()
+)
+RETURNING *;
+
+-- name: TouchExternalIdentity :exec
+UPDATE external_identities
+SET email = $2,
+    last_login_at = NOW()
+WHERE id = $1;
+
+-- name: CreateOIDCLoginState :exec
+INSERT INTO oidc_login_states (state_hash, browser_hash, nonce, code_verifier, created_at, expires_at)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    NOW(),
+    $5
+);
+
+-- name: ConsumeOIDCLoginState :one
+DELETE FROM oidc_login_states
+WHERE state_hash = $1
+    AND expires_at > NOW()
+RETURNING *;
+
+-- name: DeleteExpiredOIDCLoginStates :exec
+DELETE FROM oidc_login_states
+WHERE expires_at <= NOW();
@@ -0,0 +1,31 @@
+-- name: CreateLike :exec
+WITH inserted AS (
+    INSERT INTO likes (user_id, chirp_id, created_at)
+    VALUES ($1, $2, NOW())
+    ON CONFLICT (user_id, chirp_id) DO NOTHING
+    RETURNING chirp_id
+)
+UPDATE chirps
+SET like_count = chirps.like_count + 1
+FROM inserted
+WHERE chirps.id = inserted.chirp_id;
+
+-- name: DeleteLike :exec
+WITH deleted AS (
+    DELETE FROM likes
+    WHERE user_id = $1
+        AND chirp_id = $2
+    RETURNING chirp_id
+)
+UPDATE chirps
+SET like_count = chirps.like_count - 1
+FROM deleted
+WHERE chirps.id = deleted.chirp_id;
+
+-- name: ListChirpLikes :many
+SELECT user_id, created_at
+FROM likes
+WHERE chirp_id = sqlc.arg(chirp_id)
+    AND (created_at, user_id) < (sqlc.arg(cursor_created_at)::timestamptz, sqlc.arg(cursor_id)::uuid)
+ORDER BY created_at DESC, user_id DESC
+LIMIT sqlc.arg('limit');
@@ -0,0 +1,43 @@
+-- name: CreateLoginThrottle :exec
+INSERT INTO login_throttles (scope, key, failures, last_failure_at, locked_until)
+VALUES (
+    sqlc.arg(scope),
+    sqlc.arg(key),
+    0,
+    sqlc.arg(now),
+    sqlc.arg(now)
+)
+ON CONFLICT (scope, key) DO NOTHING;
+
+-- name: GetLoginThrottleForUpdate :one
+SELECT *
+FROM login_throttles
+WHERE scope = $1
+    AND key = $2
+FOR UPDATE;
+
+-- name: RecordLoginFailure :exec
+UPDATE login_throttles
+SET failures = sqlc.arg(failures),
+    last_failure_at = sqlc.arg(last_failure_at),
+    locked_until = GREATEST(locked_until, sqlc.arg(locked_until))
+WHERE scope = sqlc.arg(scope)
+    AND key = sqlc.arg(key);
+
+-- name: ReleaseLoginFailure :exec
+UPDATE login_throttles
+SET failures = sqlc.arg(failures),
+    locked_until = LEAST(locked_until, sqlc.arg(locked_until))
+WHERE scope = sqlc.arg(scope)
+    AND key = sqlc.arg(key);
+
+-- name: ClearLoginThrottle :execrows
+DELETE FROM login_throttles
+WHERE scope = $1
+    AND key = $2;
+
+-- name: ListLockedLoginThrottles :many
+SELECT *
+FROM login_throttles
+WHERE locked_until > sqlc.arg(now)
+ORDER BY locked_until DESC;
@@ -0,0 +1,93 @@
+-- name: CreateOAuthClient :one
+INSERT INTO oauth_clients (id, owner_id, name, secret_hash, redirect_uris, scopes, created_at)
+VALUES (
+    gen_random_uuid(),
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    NOW()
+)
+RETURNING *;
+
+-- name: GetOAuthClient :one
+SELECT *
+FROM oauth_clients
+WHERE id = $1;
+
+-- name: ListOAuthClients :many
+SELECT *
+FROM oauth_clients
+WHERE owner_id = $1
+ORDER BY created_at DESC;
+
+-- name: DeleteOAuthClient :execrows
+DELETE FROM oauth_clients
+WHERE id = $1
+    AND owner_id = $2;
+
+-- name: GetOAuthConsent :one
+SELECT *
+FROM oauth_consents
+WHERE user_id = $1
+    AND client_id = $2;
+
+-- name: UpsertOAuthConsent :exec
+INSERT INTO oauth_consents (user_id, client_id, scopes, created_at, updated_at)
+VALUES (
+    $1,
+    $2,
+    $3,
+    NOW(),
+    NOW()
+)
+ON CONFLICT (user_id, client_id) DO UPDATE
+SET scopes = EXCLUDED.scopes,
+    updated_at = NOW();
+
+-- name: ListOAuthConsents :many
+SELECT
+    oauth_consents.client_id,
+    oauth_clients.name AS client_name,
+    oauth_consents.scopes,
+    oauth_consents.created_at,
+    oauth_consents.updated_at
+FROM oauth_consents
+JOIN oauth_clients ON oauth_clients.id = oauth_consents.client_id
+WHERE oauth_consents.user_id = $1
+ORDER BY oauth_consents.updated_at DESC;
+
+-- name: DeleteOAuthConsent :execrows
+DELETE FROM oauth_consents
+WHERE user_id = $1
+    AND client_id = $2;
+
+-- name: CreateOAuthAuthorizationCode :exec
+INSERT INTO oauth_authorization_codes (
+    code_hash, client_id, user_id, redirect_uri, scopes, nonce, code_challenge, created_at, expires_at
+)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    $7,
+    NOW(),
+    $8
+);
+
+-- name: ConsumeOAuthAuthorizationCode :one
+UPDATE oauth_authorization_codes
+SET used_at = NOW()
+WHERE code_hash = $1
+    AND used_at IS NULL
+    AND expires_at > NOW()
+RETURNING *;
+
+-- name: DeleteOAuthAuthorizationCodes :exec
+DELETE FROM oauth_authorization_codes
+WHERE user_id = $1
+    AND client_id = $2;
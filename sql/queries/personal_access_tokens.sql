@@ -0,0 +1,45 @@
+-- name: CreatePersonalAccessToken :one
+INSERT INTO personal_access_tokens (id, user_id, name, token_hash, scopes, created_at, expires_at)
+VALUES (
+    gen_random_uuid(),
+    $1,
+    $2,
+    $3,
+    $4,
+    NOW(),
+    $5
+)
+RETURNING *;
+
+-- name: GetActivePersonalAccessToken :one
+SELECT *
+FROM personal_access_tokens
+WHERE token_hash = $1
+    AND revoked_at IS NULL
+    AND (expires_at IS NULL OR expires_at > NOW());
+
+-- name: TouchPersonalAccessToken :exec
+UPDATE personal_access_tokens
+SET last_used_at = sqlc.arg(now)
+WHERE id = sqlc.arg(id)
+    AND (last_used_at IS NULL OR last_used_at < sqlc.arg(touched_before));
+
+-- name: ListPersonalAccessTokens :many
+SELECT *
+FROM personal_access_tokens
+WHERE user_id = $1
+    AND revoked_at IS NULL
+ORDER BY created_at DESC;
+
+-- name: RevokePersonalAccessToken :execrows
+UPDATE personal_access_tokens
+SET revoked_at = NOW()
+WHERE id = $1
+    AND user_id = $2
+    AND revoked_at IS NULL;
+
+-- name: RevokeUserPersonalAccessTokens :exec
+UPDATE personal_access_tokens
+SET revoked_at = NOW()
+WHERE user_id = $1
+    AND revoked_at IS NULL;
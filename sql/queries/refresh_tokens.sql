@@ -1,11 +1,15 @@
 -- name: CreateRefreshToken :one
-INSERT INTO refresh_tokens (token, user_id, created_at, updated_at, expires_at)
+INSERT INTO refresh_tokens (token_hash, user_id, created_at, updated_at, expires_at, session_id, user_agent, ip, last_used_at)
 VALUES (
     $1,
     $2,
     $3,
     $4,
-    $5
+    $5,
+    $6,
+    $7,
+    $8,
+    $3
 )
 RETURNING *;
 
@@ -13,13 +17,80 @@ RETURNING *;
 UPDATE refresh_tokens
 SET revoked_at = NOW(),
     updated_at = NOW()
-WHERE token = $1
+WHERE token_hash = $1
 RETURNING *;
 
 -- name: GetuserByRefreshToken :one
 SELECT users.*
 FROM users
 JOIN refresh_tokens ON users.id = refresh_tokens.user_id
-WHERE refresh_tokens.token = $1
+WHERE refresh_tokens.token_hash = $1
     AND revoked_at IS NULL
-    AND expires_at > NOW();
\ No newline at end of file
+    AND expires_at > NOW();
+
+-- name: RevokeUserRefreshTokens :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW(),
+    updated_at = NOW()
+WHERE user_id = $1
+    AND revoked_at IS NULL;
+
+-- name: GetRefreshTokenForUpdate :one
+SELECT *
+FROM refresh_tokens
+WHERE token_hash = $1
+FOR UPDATE;
+
+-- name: RotateRefreshToken :execrows
+UPDATE refresh_tokens
+SET rotated_at = NOW(),
+    revoked_at = NOW(),
+    updated_at = NOW()
+WHERE token_hash = $1
+    AND rotated_at IS NULL
+    AND revoked_at IS NULL;
+
+-- name: RevokeSession :execrows
+UPDATE refresh_tokens
+SET revoked_at = NOW(),
+    updated_at = NOW()
+WHERE session_id = $1
+    AND user_id = $2
+    AND revoked_at IS NULL;
+
+-- name: TouchSession :exec
+UPDATE refresh_tokens
+SET last_used_at = sqlc.arg(now)
+WHERE session_id = sqlc.arg(session_id)
+    AND revoked_at IS NULL
+    AND last_used_at < sqlc.arg(touched_before);
+
+-- name: ListActiveSessions :many
+SELECT
+    rt.session_id,
+    (
+        SELECT MIN(s.created_at)
+        FROM refresh_tokens s
+        WHERE s.session_id = rt.session_id
+    )::timestamp AS created_at,
+    rt.last_used_at,
+    rt.expires_at,
+    rt.user_agent,
+    rt.ip
+FROM refresh_tokens rt
+WHERE rt.user_id = $1
+    AND rt.revoked_at IS NULL
+    AND rt.expires_at > NOW()
+ORDER BY rt.last_used_at DESC;
+
+-- name: ListUnhashedRefreshTokens :many
+SELECT token_hash
+FROM refresh_tokens
+WHERE NOT hashed;
+
+-- name: HashRefreshToken :exec
+UPDATE refresh_tokens
+SET token_hash = sqlc.arg(token_hash),
+    hashed = TRUE
+WHERE token_hash = sqlc.arg(token)
+    AND NOT hashed;
@@ -0,0 +1,28 @@
+-- Snippets mark matches with the control characters STX and ETX, which are
+-- stripped from the body first so a chirp can't fake a highlight.
+
+-- name: SearchChirpsByRank :many
+SELECT
+    sqlc.embed(chirps),
+    ts_rank(chirps.search_vector, websearch_to_tsquery('english', sqlc.arg(query)))::real AS rank,
+    ts_headline('english', translate(chirps.body, chr(2) || chr(3), ''), websearch_to_tsquery('english', sqlc.arg(query)), 'StartSel=' || chr(2) || ', StopSel=' || chr(3) || ', MaxFragments=2') AS snippet
+FROM chirps
+WHERE chirps.search_vector @@ websearch_to_tsquery('english', sqlc.arg(query))
+    AND chirps.deleted_at IS NULL
+    AND (sqlc.narg(author_id)::uuid IS NULL OR chirps.user_id = sqlc.narg(author_id))
+    AND (ts_rank(chirps.search_vector, websearch_to_tsquery('english', sqlc.arg(query)))::real, chirps.id) < (sqlc.arg(cursor_rank)::real, sqlc.arg(cursor_id)::uuid)
+ORDER BY rank DESC, chirps.id DESC
+LIMIT sqlc.arg('limit');
+
+-- name: SearchChirpsByRecency :many
+SELECT
+    sqlc.embed(chirps),
+    ts_rank(chirps.search_vector, websearch_to_tsquery('english', sqlc.arg(query)))::real AS rank,
+    ts_headline('english', translate(chirps.body, chr(2) || chr(3), ''), websearch_to_tsquery('english', sqlc.arg(query)), 'StartSel=' || chr(2) || ', StopSel=' || chr(3) || ', MaxFragments=2') AS snippet
+FROM chirps
+WHERE chirps.search_vector @@ websearch_to_tsquery('english', sqlc.arg(query))
+    AND chirps.deleted_at IS NULL
+    AND (sqlc.narg(author_id)::uuid IS NULL OR chirps.user_id = sqlc.narg(author_id))
+    AND (chirps.created_at, chirps.id) < (sqlc.arg(cursor_created_at)::timestamptz, sqlc.arg(cursor_id)::uuid)
+ORDER BY chirps.created_at DESC, chirps.id DESC
+LIMIT sqlc.arg('limit');
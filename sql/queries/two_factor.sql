@@ -0,0 +1,53 @@
+-- name: StartTOTPEnrolment :execrows
+INSERT INTO user_totp (user_id, secret, created_at)
+VALUES (
+    $1,
+    $2,
+    NOW()
+)
+ON CONFLICT (user_id) DO UPDATE
+SET secret = EXCLUDED.secret,
+    created_at = NOW(),
+    last_used_step = 0
+WHERE user_totp.confirmed_at IS NULL;
+
+-- name: GetUserTOTP :one
+SELECT *
+FROM user_totp
+WHERE user_id = $1;
+
+-- name: ConfirmTOTPEnrolment :execrows
+UPDATE user_totp
+SET confirmed_at = NOW(),
+    last_used_step = $2
+WHERE user_id = $1
+    AND confirmed_at IS NULL;
+
+-- name: UseTOTPStep :execrows
+UPDATE user_totp
+SET last_used_step = $2
+WHERE user_id = $1
+    AND last_used_step < $2;
+
+-- name: DeleteUserTOTP :exec
+DELETE FROM user_totp
+WHERE user_id = $1;
+
+-- name: CreateRecoveryCode :exec
+INSERT INTO recovery_codes (user_id, code_hash, created_at)
+VALUES (
+    $1,
+    $2,
+    NOW()
+);
+
+-- name: DeleteRecoveryCodes :exec
+DELETE FROM recovery_codes
+WHERE user_id = $1;
+
+-- name: UseRecoveryCode :execrows
+UPDATE recovery_codes
+SET used_at = NOW()
+WHERE user_id = $1
+    AND code_hash = $2
+    AND used_at IS NULL;
@@ -15,11 +15,38 @@ SELECT *
 FROM users
 WHERE email = $1;
 
--- name: UpdateUser :one
+-- name: UpdateUserEmail :one
 UPDATE users
 SET
     email = $2,
-    hashed_password = $3,
+    email_verified_at = NOW(),
+    updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: UpdateUserPassword :one
+UPDATE users
+SET
+    hashed_password = $2,
+    updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: UpdateUserProfile :one
+UPDATE users
+SET
+    username = COALESCE(sqlc.narg(username), username),
+    display_name = COALESCE(sqlc.narg(display_name), display_name),
+    bio = COALESCE(sqlc.narg(bio), bio),
+    avatar_url = COALESCE(sqlc.narg(avatar_url), avatar_url),
+    updated_at = NOW()
+WHERE id = sqlc.arg(id)
+RETURNING *;
+
+-- name: MarkUserEmailVerified :one
+UPDATE users
+SET
+    email_verified_at = COALESCE(email_verified_at, NOW()),
     updated_at = NOW()
 WHERE id = $1
 RETURNING *;
@@ -31,3 +58,33 @@ SET
     updated_at = NOW()
 WHERE id = $1
 RETURNING *;
+
+-- name: GetUserByID :one
+SELECT *
+FROM users
+WHERE id = $1;
+
+-- name: GetUserByUsername :one
+SELECT *
+FROM users
+WHERE LOWER(username) = LOWER(sqlc.arg(username));
+
+-- name: GetUsersByUsernames :many
+SELECT id, LOWER(username) AS username
+FROM users
+WHERE LOWER(username) = ANY(sqlc.arg(usernames)::text[]);
+
+-- name: RehashUserPassword :execrows
+UPDATE users
+SET hashed_password = sqlc.arg(new_hash)
+WHERE id = sqlc.arg(id)
+    AND hashed_password = sqlc.arg(old_hash);
+
+-- name: CountUsersByPasswordParams :many
+SELECT
+    split_part(hashed_password, '$', 4)::TEXT AS params,
+    length(split_part(hashed_password, '$', 5))::INT AS salt_chars,
+    length(split_part(hashed_password, '$', 6))::INT AS key_chars,
+    COUNT(*) AS users
+FROM users
+GROUP BY 1, 2, 3;
@@ -0,0 +1,16 @@
+-- +goose Up
+ALTER TABLE chirps
+ADD COLUMN quoted_chirp_id UUID REFERENCES chirps(id) ON DELETE SET NULL,
+ADD COLUMN rechirp_of UUID REFERENCES chirps(id) ON DELETE CASCADE;
+
+CREATE INDEX chirps_quoted_chirp_id_idx ON chirps (quoted_chirp_id);
+CREATE UNIQUE INDEX chirps_user_id_rechirp_of_idx ON chirps (user_id, rechirp_of)
+WHERE rechirp_of IS NOT NULL;
+
+-- +goose Down
+DROP INDEX chirps_user_id_rechirp_of_idx;
+DROP INDEX chirps_quoted_chirp_id_idx;
+
+ALTER TABLE chirps
+DROP COLUMN rechirp_of,
+DROP COLUMN quoted_chirp_id;
@@ -0,0 +1,21 @@
+-- +goose Up
+CREATE TABLE chirp_entities (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    chirp_id UUID NOT NULL REFERENCES chirps(id) ON DELETE CASCADE,
+    kind TEXT NOT NULL,
+    text TEXT NOT NULL,
+    normalized TEXT NOT NULL,
+    user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    byte_start INTEGER NOT NULL,
+    byte_end INTEGER NOT NULL,
+    char_start INTEGER NOT NULL,
+    char_end INTEGER NOT NULL
+);
+
+CREATE INDEX chirp_entities_chirp_id_idx ON chirp_entities (chirp_id);
+CREATE INDEX chirp_entities_kind_normalized_idx ON chirp_entities (kind, normalized, chirp_id);
+CREATE INDEX chirp_entities_user_id_idx ON chirp_entities (user_id, chirp_id)
+WHERE user_id IS NOT NULL;
+
+-- +goose Down
+DROP TABLE chirp_entities;
@@ -0,0 +1,17 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN username TEXT,
+ADD COLUMN display_name TEXT NOT NULL DEFAULT '',
+ADD COLUMN bio TEXT NOT NULL DEFAULT '',
+ADD COLUMN avatar_url TEXT NOT NULL DEFAULT '';
+
+CREATE UNIQUE INDEX users_username_lower_idx ON users (LOWER(username));
+
+-- +goose Down
+DROP INDEX users_username_lower_idx;
+
+ALTER TABLE users
+DROP COLUMN avatar_url,
+DROP COLUMN bio,
+DROP COLUMN display_name,
+DROP COLUMN username;
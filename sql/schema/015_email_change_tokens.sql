@@ -0,0 +1,14 @@
+-- +goose Up
+CREATE TABLE email_change_tokens (
+    token_hash TEXT PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    new_email TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ
+);
+
+CREATE INDEX email_change_tokens_user_id_idx ON email_change_tokens (user_id);
+
+-- +goose Down
+DROP TABLE email_change_tokens;
@@ -0,0 +1,18 @@
+-- +goose Up
+-- Rotated refresh tokens keep the session_id of the token they replaced, so
+-- all the tokens from one login form a session.
+ALTER TABLE refresh_tokens
+ADD COLUMN session_id UUID,
+ADD COLUMN rotated_at TIMESTAMP;
+
+-- Tokens issued before rotation each start their own session.
+UPDATE refresh_tokens SET session_id = gen_random_uuid();
+
+ALTER TABLE refresh_tokens ALTER COLUMN session_id SET NOT NULL;
+
+CREATE INDEX refresh_tokens_session_id_idx ON refresh_tokens (session_id);
+
+-- +goose Down
+ALTER TABLE refresh_tokens
+DROP COLUMN rotated_at,
+DROP COLUMN session_id;
@@ -0,0 +1,14 @@
+-- +goose Up
+ALTER TABLE refresh_tokens RENAME COLUMN token TO token_hash;
+
+-- Existing rows still hold the raw token. The HMAC key isn't available to
+-- SQL, so the server rewrites these rows at startup and flips the flag.
+ALTER TABLE refresh_tokens ADD COLUMN hashed BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE refresh_tokens ALTER COLUMN hashed SET DEFAULT TRUE;
+
+-- +goose Down
+-- Hashed tokens can't be turned back into usable ones; those sessions end.
+DELETE FROM refresh_tokens WHERE hashed;
+
+ALTER TABLE refresh_tokens DROP COLUMN hashed;
+ALTER TABLE refresh_tokens RENAME COLUMN token_hash TO token;
@@ -0,0 +1,16 @@
+-- +goose Up
+-- Where each session was started from and when it was last used.
+ALTER TABLE refresh_tokens
+ADD COLUMN user_agent TEXT NOT NULL DEFAULT '',
+ADD COLUMN ip TEXT NOT NULL DEFAULT '',
+ADD COLUMN last_used_at TIMESTAMP;
+
+UPDATE refresh_tokens SET last_used_at = created_at;
+
+ALTER TABLE refresh_tokens ALTER COLUMN last_used_at SET NOT NULL;
+
+-- +goose Down
+ALTER TABLE refresh_tokens
+DROP COLUMN last_used_at,
+DROP COLUMN ip,
+DROP COLUMN user_agent;
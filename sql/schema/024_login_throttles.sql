@@ -0,0 +1,16 @@
+-- +goose Up
+-- Failed login attempts per account (scope 'account', keyed by the lowercased
+-- email, whether or not it belongs to a user) and per client IP (scope 'ip').
+CREATE TABLE login_throttles (
+    scope TEXT NOT NULL,
+    key TEXT NOT NULL,
+    failures INTEGER NOT NULL,
+    last_failure_at TIMESTAMPTZ NOT NULL,
+    locked_until TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (scope, key)
+);
+
+CREATE INDEX login_throttles_locked_until_idx ON login_throttles (locked_until);
+
+-- +goose Down
+DROP TABLE login_throttles;
@@ -0,0 +1,30 @@
+-- +goose Up
+-- Accounts at external OpenID Connect providers that users sign in with.
+-- An identity is the issuer and subject pair from the provider's ID token.
+CREATE TABLE external_identities (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    issuer TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    email TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_login_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (issuer, subject)
+);
+
+CREATE INDEX external_identities_user_id_idx ON external_identities (user_id);
+
+-- Logins in progress at an external provider. A state is consumed by the
+-- callback, which must come from the browser holding the matching cookie.
+CREATE TABLE oidc_login_states (
+    state_hash TEXT PRIMARY KEY,
+    browser_hash TEXT NOT NULL,
+    nonce TEXT NOT NULL,
+    code_verifier TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+-- +goose Down
+DROP TABLE oidc_login_states;
+DROP TABLE external_identities;
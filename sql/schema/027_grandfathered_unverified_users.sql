@@ -0,0 +1,10 @@
+-- +goose Up
+-- Accounts that existed before email verification never had their address
+-- checked. They may keep chirping when REQUIRE_VERIFIED_EMAIL is turned on,
+-- but their address still counts as unverified for everything else.
+ALTER TABLE users ADD COLUMN grandfathered_unverified BOOLEAN NOT NULL DEFAULT FALSE;
+
+UPDATE users SET grandfathered_unverified = TRUE WHERE email_verified_at IS NULL;
+
+-- +goose Down
+ALTER TABLE users DROP COLUMN grandfathered_unverified;
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/Skorgum/Chirpy/internal/auth"
+	"github.com/Skorgum/Chirpy/internal/database"
+)
+
+func (cfg *apiConfig) tokenLifetimesFor(user database.User) auth.TokenLifetimes {
+	return cfg.tokenLifetimes.For(user.IsChirpyRed)
+}
+
+// tokenLifetimesFromEnv reads the standard and Chirpy Red token lifetimes.
+// Every variable is optional; Red plans default to the standard limits
+// except for a longer refresh token.
+func tokenLifetimesFromEnv() (auth.PlanTokenLifetimes, error) {
+	var standard, red auth.TokenLifetimes
+	var err error
+
+	if standard.AccessTTL, err = durationFromEnv("ACCESS_TOKEN_TTL", time.Hour); err != nil {
+		return auth.PlanTokenLifetimes{}, err
+	}
+	if standard.MaxAccessTTL, err = durationFromEnv("ACCESS_TOKEN_MAX_TTL", standard.AccessTTL); err != nil {
+		return auth.PlanTokenLifetimes{}, err
+	}
+	if standard.RefreshTTL, err = durationFromEnv("REFRESH_TOKEN_TTL", 60*24*time.Hour); err != nil {
+		return auth.PlanTokenLifetimes{}, err
+	}
+
+	red.AccessTTL = standard.AccessTTL
+	if red.MaxAccessTTL, err = durationFromEnv("CHIRPY_RED_ACCESS_TOKEN_MAX_TTL", standard.MaxAccessTTL); err != nil {
+		return auth.PlanTokenLifetimes{}, err
+	}
+	if red.RefreshTTL, err = durationFromEnv("CHIRPY_RED_REFRESH_TOKEN_TTL", 90*24*time.Hour); err != nil {
+		return auth.PlanTokenLifetimes{}, err
+	}
+
+	for _, l := range []auth.TokenLifetimes{standard, red} {
+		if l.MaxAccessTTL < l.AccessTTL {
+			return auth.PlanTokenLifetimes{}, fmt.Errorf("maximum access token lifetime %s is shorter than the default %s", l.MaxAccessTTL, l.AccessTTL)
+		}
+	}
+	return auth.PlanTokenLifetimes{Standard: standard, ChirpyRed: red}, nil
+}
+
+func durationFromEnv(name string, fallback time.Duration) (time.Duration, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("invalid %s: must be positive", name)
+	}
+	return d, nil
+}